@@ -1,21 +1,22 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
-
-	"github.com/hitjim/ting-bill-split/internal/tingcsv"
+	"strings"
 
 	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/hitjim/ting-bill-split/internal/tingcsv"
 	"github.com/hitjim/ting-bill-split/internal/tingparse"
 	"github.com/hitjim/ting-bill-split/internal/tingpdf"
-
-	"github.com/BurntSushi/toml"
+	"github.com/hitjim/ting-bill-split/internal/tingvalidate"
 )
 
 func checkParam(param string, ptr *string, badParam *bool) {
@@ -38,58 +39,135 @@ func createNewBillingDir(args []string) {
 			if err := os.MkdirAll(newDirName, os.ModePerm); err != nil {
 				log.Fatal("Failed to create new billing directory: ", err)
 			}
-			createBillFile(newDirName)
+			createBillFile(newDirName, nil)
 			fmt.Printf("\n1. Enter values for the bill.toml file in new directory `%s`\n", newDirName)
 			fmt.Println("2. Add csv files for minutes, message, megabytes in the new directory")
 			fmt.Printf("3. run `tingbill dir %s`\n", newDirName)
+		} else if _, err := os.Stat(filepath.Join(newDirName, "bill.toml")); os.IsNotExist(err) {
+			// The csv files are already there, so the devices can be filled in from them
+			deviceIds, err := usageDeviceIds(newDirName)
+			if err != nil {
+				log.Fatal("Failed to read usage csv files: ", err)
+			}
+			createBillFile(newDirName, deviceIds)
+			fmt.Printf("\nFound %d devices in the csv files in `%s`.\n", len(deviceIds), newDirName)
+			fmt.Printf("\n1. Enter values and owners for the bill.toml file in `%s`\n", newDirName)
+			fmt.Printf("2. run `tingbill dir %s`\n", newDirName)
 		} else {
 			fmt.Println("Directory already exists.")
 		}
 	}
 }
 
-func createBillFile(path string) {
+// newBillTemplate is written to bill.toml by `tingbill new`. It's hand-crafted rather than
+// encoded from a tingbill.Bill, so values can be grouped sensibly and carry helpful comments.
+// The devices are written after it, see newDevicesTemplate.
+const newBillTemplate = `# Optional, the reports are named after the billing period in the csv files without it
+# description = "Ting 2019-09-03..2019-10-02"
+
+# US Dollar amounts from the Ting bill, like 48, 48.00 or "48.00"
+total = 0.00
+
+devicesCost = 0.00
+
+minutes = 0.00
+messages = 0.00
+megabytes = 0.00
+
+extraMinutes = 0.00
+extraMessages = 0.00
+extraMegabytes = 0.00
+
+fees = 0.00
+
+shortStrawId = "%s"
+`
+
+// newDevicesTemplate is written to bill.toml by `tingbill new` for each device.
+const newDevicesTemplate = `
+[[devices]]
+deviceId = "%s"
+owner = "%s"
+`
+
+// exampleDevices are the devices written to a new bill.toml when there aren't any csv files.
+var exampleDevices = []tingbill.Device{
+	{DeviceID: "1112223333", Owner: "owner1"},
+	{DeviceID: "2229998888", Owner: "owner2"},
+	{DeviceID: "3331119999", Owner: "owner1"},
+}
+
+// usageDeviceIds returns every deviceId in the minutes, messages and megabytes csv files in the
+// directory at path, sorted. Files which aren't there are skipped.
+func usageDeviceIds(path string) ([]string, error) {
+	var u tingparse.Usage
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(path, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		opts := tingparse.ParseOptions{File: file.Name()}
+
+		switch {
+		case isFileMatch(file.Name(), "minutes", "csv"):
+			u.Minutes, _, err = tingparse.ParseMinutes(f, opts)
+		case isFileMatch(file.Name(), "messages", "csv"):
+			u.Messages, _, err = tingparse.ParseMessages(f, opts)
+		case isFileMatch(file.Name(), "megabytes", "csv"):
+			u.Megabytes, _, err = tingparse.ParseMegabytes(f, opts)
+		}
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return u.DeviceIDs(), nil
+}
+
+// newBill returns the contents of a new bill.toml, with a device for each of deviceIds, owned by
+// tingbill.UnknownOwner until it's filled in. Without any deviceIds, it has the exampleDevices.
+func newBill(deviceIds []string) string {
+	devices := exampleDevices
+	if len(deviceIds) > 0 {
+		devices = nil
+		for _, id := range deviceIds {
+			devices = append(devices, tingbill.Device{DeviceID: id, Owner: tingbill.UnknownOwner})
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, newBillTemplate, devices[0].DeviceID)
+	for _, d := range devices {
+		fmt.Fprintf(&sb, newDevicesTemplate, d.DeviceID, d.Owner)
+	}
+
+	return sb.String()
+}
+
+func createBillFile(path string, deviceIds []string) {
 	path += "/bill.toml"
 	f, err := os.Create(path)
 
 	if err != nil {
 		panic(err)
 	}
+	defer f.Close()
 
-	// TODO - instead of encoding the struct, maybe define the newBill to ensure we
-	// don't forget to create requisite parts in the toml, but then use the newBill
-	// to "hand-craft" the example toml. So we can group values in a sensible way
-	// and provide helpful comment text
-	newBill := tingbill.Bill{
-		Description: "Ting Bill Split YYYY-MM-DD",
-		Devices: []tingbill.Device{
-			tingbill.Device{
-				DeviceID: "1112223333",
-				Owner:    "owner1",
-			},
-			tingbill.Device{
-				DeviceID: "2229998888",
-				Owner:    "owner2",
-			},
-			tingbill.Device{
-				DeviceID: "3331119999",
-				Owner:    "owner1",
-			},
-		},
-		ShortStrawID:   "1112223333",
-		Total:          0.00,
-		DevicesCost:    0.00,
-		Minutes:        0.00,
-		Messages:       0.00,
-		Megabytes:      0.00,
-		ExtraMinutes:   0.00,
-		ExtraMessages:  0.00,
-		ExtraMegabytes: 0.00,
-		Fees:           0.00,
-	}
-
-	if err := toml.NewEncoder(f).Encode(newBill); err != nil {
-		log.Fatalf("Error encoding TOML: %s", err)
+	if _, err := f.WriteString(newBill(deviceIds)); err != nil {
+		log.Fatalf("Error writing bill.toml: %s", err)
 	}
 }
 
@@ -107,7 +185,10 @@ func isFileMatch(fileName string, nameTerm string, ext string) bool {
 	return r.MatchString(fileName)
 }
 
-func parseDir(path string) {
+// calculateDir finds the bill.toml and usage CSV files in the directory at path, and returns
+// the tingbill.Bill and its tingbill.BillSplit. With lenient, bad rows in the CSV files are
+// skipped, and returned as warnings.
+func calculateDir(path string, lenient bool, w io.Writer) (tingbill.Bill, tingbill.BillSplit, error) {
 	var billFile *os.File
 	var minFile *os.File
 	var msgFile *os.File
@@ -116,138 +197,261 @@ func parseDir(path string) {
 	files, err := ioutil.ReadDir(path)
 
 	if err != nil {
-		log.Fatal(err)
+		return tingbill.Bill{}, tingbill.BillSplit{}, err
 	}
 
 	for _, file := range files {
 		if file.IsDir() {
-			fmt.Printf("Directory \"%v\" found, continuing...\n", file.Name())
+			fmt.Fprintf(w, "Directory \"%v\" found, continuing...\n", file.Name())
 			continue
 		}
 
 		if billFile == nil && isFileMatch(file.Name(), "bill", "toml") {
 			billFile, err = os.Open(filepath.Join(path, file.Name()))
 			if err != nil {
-				log.Fatal(err)
+				return tingbill.Bill{}, tingbill.BillSplit{}, err
 			}
+			defer billFile.Close()
 		}
 
 		if minFile == nil && isFileMatch(file.Name(), "minutes", "csv") {
 			minFile, err = os.Open(filepath.Join(path, file.Name()))
 			if err != nil {
-				log.Fatal(err)
+				return tingbill.Bill{}, tingbill.BillSplit{}, err
 			}
+			defer minFile.Close()
 		}
 
 		if msgFile == nil && isFileMatch(file.Name(), "messages", "csv") {
 			msgFile, err = os.Open(filepath.Join(path, file.Name()))
 			if err != nil {
-				log.Fatal(err)
+				return tingbill.Bill{}, tingbill.BillSplit{}, err
 			}
+			defer msgFile.Close()
 		}
 
 		if megFile == nil && isFileMatch(file.Name(), "megabytes", "csv") {
 			megFile, err = os.Open(filepath.Join(path, file.Name()))
 			if err != nil {
-				log.Fatal(err)
+				return tingbill.Bill{}, tingbill.BillSplit{}, err
 			}
+			defer megFile.Close()
 		}
 	}
 
-	if billFile == nil || minFile == nil || msgFile == nil || megFile == nil {
-		fmt.Println("Unable to open necessary files.")
+	if billFile == nil {
+		return tingbill.Bill{}, tingbill.BillSplit{}, errors.New("unable to open necessary files, bill file not found")
+	}
 
-		if billFile == nil {
-			fmt.Println("Bill file not found.")
-			return
-		}
+	if minFile == nil {
+		return tingbill.Bill{}, tingbill.BillSplit{}, errors.New("unable to open necessary files, minutes file not found")
+	}
 
-		if minFile == nil {
-			fmt.Println("Minutes file not found.")
-			return
-		}
+	if msgFile == nil {
+		return tingbill.Bill{}, tingbill.BillSplit{}, errors.New("unable to open necessary files, messages file not found")
+	}
 
-		if msgFile == nil {
-			fmt.Println("Messages file not found.")
-			return
-		}
+	if megFile == nil {
+		return tingbill.Bill{}, tingbill.BillSplit{}, errors.New("unable to open necessary files, megabytes file not found")
+	}
 
-		if megFile == nil {
-			fmt.Println("Megabytes file not found.")
-			return
-		}
+	fmt.Fprintf(w, "\nRunning calculations based on files in directory: %s\n\n", path)
+
+	billData, err := tingparse.ParseBill(billFile)
+	if err != nil {
+		return billData, tingbill.BillSplit{}, err
+	}
+
+	minRecords, minWarnings, err := tingparse.ParseMinutes(minFile, tingparse.ParseOptions{File: filepath.Base(minFile.Name()), Lenient: lenient})
+	if err != nil {
+		return billData, tingbill.BillSplit{}, lenientHint(err)
+	}
+
+	msgRecords, msgWarnings, err := tingparse.ParseMessages(msgFile, tingparse.ParseOptions{File: filepath.Base(msgFile.Name()), Lenient: lenient})
+	if err != nil {
+		return billData, tingbill.BillSplit{}, lenientHint(err)
+	}
+
+	megRecords, megWarnings, err := tingparse.ParseMegabytes(megFile, tingparse.ParseOptions{File: filepath.Base(megFile.Name()), Lenient: lenient})
+	if err != nil {
+		return billData, tingbill.BillSplit{}, lenientHint(err)
+	}
+
+	usage := tingparse.Usage{Minutes: minRecords, Messages: msgRecords, Megabytes: megRecords}
+	billData, periodWarnings := tingparse.WithUsagePeriod(billData, usage)
+
+	// Without a description or usage dates to name the reports by, they're named after the directory
+	if billData.Description == "" {
+		billData.Description = filepath.Base(path)
+	}
+
+	split, err := tingparse.CalculateSplit(usage, billData)
+	billData.Devices = append(billData.Devices, split.AddedDevices...)
+
+	// Parsing warnings come first, since they happened first
+	warnings := append(append(append(minWarnings, msgWarnings...), megWarnings...), periodWarnings...)
+	split.Warnings = append(warnings, split.Warnings...)
+
+	return billData, split, err
+}
+
+// parseDir splits the bill in the directory at path, and writes the PDF and CSV reports there.
+// Warnings are written to w, and progress to messageWriter(w, verbosity), so json verbosity
+// leaves only the JSON in w.
+func parseDir(w io.Writer, path string, opts tingpdf.Options, verbosity string, lenient bool) {
+	msgs := messageWriter(w, verbosity)
+
+	billData, split, err := calculateDir(path, lenient, msgs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Reconcile before generating anything, so mismatches show up with the other warnings
+	report := tingvalidate.Split(split, billData)
+	split.Warnings = append(split.Warnings, report.Warnings()...)
+
+	if err := renderWarnings(w, split.Warnings, verbosity); err != nil {
+		log.Fatal(err)
+	}
+
+	if !report.OK() && verbosity != verbosityQuiet && verbosity != verbosityJSON {
+		fmt.Fprintf(msgs, "\nThe bill doesn't reconcile, run `tingbill validate %s` for a breakdown.\n", path)
+	}
+
+	fmt.Fprintf(msgs, "\nGenerating invoice PDF...\n")
+	pdfFilePath := filepath.Join(path, billData.Description+".pdf")
+	invoiceName, err := tingpdf.GeneratePDF(split, billData, pdfFilePath, opts)
+	if err != nil {
+		fmt.Fprintf(msgs, "Failed to generate PDF invoice at path: %v\n\n", pdfFilePath)
+		log.Fatal(err)
+	}
+	fmt.Fprintf(msgs, "PDF invoice generation complete: %s\n", invoiceName)
+
+	fmt.Fprintf(msgs, "\nGenerating invoice CSV...\n")
+	csvFilePath := filepath.Join(path, billData.Description+"_report.csv")
+	invoiceName, err = tingcsv.GenerateCSV(split, billData, csvFilePath)
+	if err != nil {
+		fmt.Fprintf(msgs, "Failed to generate CSV record at path: %v\n\n", csvFilePath)
+		log.Fatal(err)
+	}
+	fmt.Fprintf(msgs, "CSV invoice generation complete: %s\n\n", invoiceName)
+
+	printBadRows(msgs, split.Warnings, verbosity)
+}
+
+// validateDir reconciles the bill and usage in the directory at path, and prints every check.
+// It doesn't write any files. Returns false if any check failed. Warnings are written to w, and
+// everything else to messageWriter(w, verbosity), like with parseDir.
+func validateDir(w io.Writer, path string, verbosity string, lenient bool) bool {
+	msgs := messageWriter(w, verbosity)
+
+	billData, split, err := calculateDir(path, lenient, msgs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := renderWarnings(w, split.Warnings, verbosity); err != nil {
+		log.Fatal(err)
+	}
+
+	report := tingvalidate.Split(split, billData)
+	for _, line := range report.Lines() {
+		fmt.Fprintln(msgs, line)
+	}
+
+	if report.OK() {
+		fmt.Fprintf(msgs, "\nEverything adds up.\n\n")
 	} else {
-		fmt.Printf("\nRunning calculations based on files in directory: %s\n\n", path)
+		fmt.Fprintf(msgs, "\nThe bill doesn't reconcile, check bill.toml against the Ting bill.\n\n")
+	}
 
-		billData, err := tingparse.ParseBill(billFile)
-		if err != nil {
-			log.Fatal(err)
-		}
+	printBadRows(msgs, split.Warnings, verbosity)
 
-		minMap, err := tingparse.ParseMinutes(minFile)
-		if err != nil {
-			log.Fatal(err)
-		}
+	return report.OK()
+}
 
-		msgMap, err := tingparse.ParseMessages(msgFile)
-		if err != nil {
-			log.Fatal(err)
-		}
+// explainDir prints every step of the calculation for a deviceId or owner, using the files in
+// the directory at path. Warnings are written to w, and the steps to messageWriter(w, verbosity).
+func explainDir(w io.Writer, path string, who string, verbosity string, lenient bool) {
+	msgs := messageWriter(w, verbosity)
 
-		megMap, err := tingparse.ParseMegabytes(megFile)
-		if err != nil {
-			log.Fatal(err)
-		}
+	billData, split, err := calculateDir(path, lenient, msgs)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		split, err := tingparse.CalculateSplit(minMap, msgMap, megMap, billData)
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err := renderWarnings(w, split.Warnings, verbosity); err != nil {
+		log.Fatal(err)
+	}
 
-		pdfFilePath := filepath.Join(path, billData.Description+".pdf")
-		invoiceName, err := tingpdf.GeneratePDF(split, billData, pdfFilePath)
-		if err != nil {
-			fmt.Printf("Failed to generate PDF invoice at path: %v\n\n", pdfFilePath)
-			log.Fatal(err)
-		}
-		fmt.Printf("PDF invoice generation complete: %s\n", invoiceName)
+	lines, err := split.Explain(billData, who)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		csvFilePath := filepath.Join(path, billData.Description+"_report.csv")
-		invoiceName, err = tingcsv.GenerateCSV(split, billData, csvFilePath)
-		if err != nil {
-			fmt.Printf("Failed to generate CSV record at path: %v\n\n", csvFilePath)
-			log.Fatal(err)
-		}
-		fmt.Printf("CSV invoice generation complete: %s\n\n", invoiceName)
+	for _, line := range lines {
+		fmt.Fprintln(msgs, line)
 	}
+	fmt.Fprintln(msgs)
+
+	printBadRows(msgs, split.Warnings, verbosity)
+}
+
+// fullDirPath returns targetDir as an absolute path, relative to the working directory.
+func fullDirPath(targetDir string) (string, error) {
+	// Handle absolute and relative paths, respectively
+	if filepath.IsAbs(targetDir) {
+		return targetDir, nil
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Could not get working directory")
+		return "", err
+	}
+
+	return filepath.Join(workingDir, targetDir), nil
 }
 
 func printUsageHelp() {
 	fmt.Println("Use `tingbill new` or `tingbill new <billing-directory>` to create a new billing directory")
 	fmt.Println("\nUse `tingbill dir <billing-directory>` to run on a directory containing a `bill.toml`, and CSV files for minutes, messages, and megabytes usage.")
 	fmt.Println("  Each of these files must contain their type somewhere in the filename - i.e. `YYYYMMDD-messages.csv` or `messages-potatosalad.csv` or whatever.")
+	fmt.Println("  Use `tingbill -methodology dir <billing-directory>` to add a page explaining the calculation to the PDF.")
+	fmt.Println("\nUse `tingbill validate <billing-directory>` to check that the bill and the split add up, without generating any files.")
+	fmt.Println("\nUse `tingbill explain <billing-directory> <deviceId|owner>` to show every step of the calculation for a phone number or owner.")
 }
 
 func main() {
-	fmt.Printf("\nTING BILL SPLIT\n")
-	fmt.Println("***************")
-
 	billPtr := flag.String("bill", "", "filename for bill toml - ex: -bill=\"bill.toml\"")
 	minPtr := flag.String("minutes", "", "filename for minutes csv - ex: -minutes=\"minutes.csv\"")
 	msgPtr := flag.String("messages", "", "filename for messages csv - ex: -messages=\"messages.csv\"")
 	megPtr := flag.String("megabytes", "", "filename for megabytes csv - ex: -megabytes=\"megabytes.csv\"")
+	verbosityPtr := flag.String("verbosity", verbosityNormal, "how warnings are shown: quiet, normal, verbose (includes info) or json")
+	methodologyPtr := flag.Bool("methodology", false, "add a methodology page to the PDF, explaining the calculation for every device")
+	lenientPtr := flag.Bool("lenient", false, "skip bad rows in the csv files, and list them at the end, instead of stopping at the first one")
 
 	flag.Parse()
 	args := flag.Args()
 	targetDir := "."
 
+	if !validVerbosity(*verbosityPtr) {
+		fmt.Printf("Unknown verbosity %q, use quiet, normal, verbose or json\n", *verbosityPtr)
+		os.Exit(1)
+	}
+
+	msgs := messageWriter(os.Stdout, *verbosityPtr)
+
+	fmt.Fprintf(msgs, "\nTING BILL SPLIT\n")
+	fmt.Fprintln(msgs, "***************")
+
 	if len(args) == 0 {
 		fmt.Printf("`help`: usage guide for running batch mode against a single directory (recommended)\n")
 		fmt.Printf("`-h`: usage guide for running with individual file flags\n\n")
 	}
 
 	if len(args) > 0 {
-		fmt.Println("BATCH MODE")
+		fmt.Fprintln(msgs, "BATCH MODE")
 
 		command := args[0]
 
@@ -255,32 +459,45 @@ func main() {
 		case "new":
 			createNewBillingDir(args)
 		case "dir":
-			workingDir, err := os.Getwd()
+			if len(args) > 1 {
+				targetDir = args[1]
+			}
+
+			fullTargetDir, err := fullDirPath(targetDir)
 			if err != nil {
-				fmt.Println("Could not get working directory")
 				log.Fatal(err)
 			}
 
+			if filepath.IsAbs(fullTargetDir) {
+				parseDir(os.Stdout, fullTargetDir, tingpdf.Options{Methodology: *methodologyPtr}, *verbosityPtr, *lenientPtr)
+			} else {
+				fmt.Printf("Bill directory %v is invalid\n\n", fullTargetDir)
+			}
+		case "validate":
 			if len(args) > 1 {
 				targetDir = args[1]
 			}
 
-			fullTargetDir := ""
+			fullTargetDir, err := fullDirPath(targetDir)
+			if err != nil {
+				log.Fatal(err)
+			}
 
-			// Handle absolute and relative paths, respectively
-			if filepath.IsAbs(targetDir) {
-				fullTargetDir = targetDir
-			} else {
-				fullTargetDir = filepath.Join(workingDir, targetDir)
+			if !validateDir(os.Stdout, fullTargetDir, *verbosityPtr, *lenientPtr) {
+				os.Exit(1)
+			}
+		case "explain":
+			if len(args) != 3 {
+				fmt.Println("Syntax: `explain <billing-directory> <deviceId|owner>`")
+				break
 			}
 
-			if filepath.IsAbs(fullTargetDir) {
-				parseDir(fullTargetDir)
-				// TODO - make parseDir return a split, since non-dir parsing uses a split
-				//   then handle all actions after the if/else. Maybe?
-			} else {
-				fmt.Printf("Bill directory %v is invalid\n\n", fullTargetDir)
+			fullTargetDir, err := fullDirPath(args[1])
+			if err != nil {
+				log.Fatal(err)
 			}
+
+			explainDir(os.Stdout, fullTargetDir, args[2], *verbosityPtr, *lenientPtr)
 		case "help":
 			printUsageHelp()
 		default:
@@ -304,7 +521,7 @@ func main() {
 		}
 
 		if flagUsed {
-			fmt.Println("RUNNING WITH INDIVIDUAL FILE FLAGS")
+			fmt.Fprintln(msgs, "RUNNING WITH INDIVIDUAL FILE FLAGS")
 			for k, v := range paramMap {
 				checkParam(k, v, &badParam)
 			}
@@ -338,26 +555,37 @@ func main() {
 				log.Fatal(err)
 			}
 
-			minMap, err := tingparse.ParseMinutes(minFile)
+			minRecords, minWarnings, err := tingparse.ParseMinutes(minFile, tingparse.ParseOptions{File: *minPtr, Lenient: *lenientPtr})
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			msgMap, err := tingparse.ParseMessages(msgFile)
+			msgRecords, msgWarnings, err := tingparse.ParseMessages(msgFile, tingparse.ParseOptions{File: *msgPtr, Lenient: *lenientPtr})
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			megMap, err := tingparse.ParseMegabytes(megFile)
+			megRecords, megWarnings, err := tingparse.ParseMegabytes(megFile, tingparse.ParseOptions{File: *megPtr, Lenient: *lenientPtr})
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			split, err := tingparse.CalculateSplit(minMap, msgMap, megMap, billData)
+			usage := tingparse.Usage{Minutes: minRecords, Messages: msgRecords, Megabytes: megRecords}
+			billData, periodWarnings := tingparse.WithUsagePeriod(billData, usage)
+
+			split, err := tingparse.CalculateSplit(usage, billData)
 			if err != nil {
 				log.Fatal(err)
 			}
-			fmt.Println(split)
+			billData.Devices = append(billData.Devices, split.AddedDevices...)
+
+			warnings := append(append(append(minWarnings, msgWarnings...), megWarnings...), periodWarnings...)
+			warnings = append(warnings, split.Warnings...)
+			if err := renderWarnings(os.Stdout, warnings, *verbosityPtr); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintln(msgs, split)
+			printBadRows(msgs, warnings, *verbosityPtr)
 		}
 	}
 }
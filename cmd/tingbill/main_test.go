@@ -1,7 +1,18 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/hitjim/ting-bill-split/internal/tingparse"
+	"github.com/hitjim/ting-bill-split/internal/tingpdf"
 )
 
 func TestIsFileMatch(t *testing.T) {
@@ -122,3 +133,171 @@ func TestIsFileMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestNewBill(t *testing.T) {
+	cases := []struct {
+		deviceIds []string
+		want      []string
+		wantOwner string
+	}{
+		{nil, []string{"1112223333", "2229998888", "3331119999"}, ""},
+		{[]string{"1112224444", "1112225555"}, []string{"1112224444", "1112225555"}, tingbill.UnknownOwner},
+	}
+
+	for _, c := range cases {
+		b, err := tingparse.ParseBill(strings.NewReader(newBill(c.deviceIds)))
+		if err != nil {
+			t.Fatalf("ParseBill(newBill(%v)) err, %v", c.deviceIds, err)
+		}
+
+		if got := b.DeviceIds(); !cmp.Equal(got, c.want) {
+			t.Errorf("ParseBill(newBill(%v)) deviceIds == %v, want %v", c.deviceIds, got, c.want)
+		}
+
+		if b.ShortStrawID != c.want[0] {
+			t.Errorf("ParseBill(newBill(%v)) shortStrawId == %s, want %s", c.deviceIds, b.ShortStrawID, c.want[0])
+		}
+
+		if c.wantOwner != "" && b.OwnerByID(c.want[0]) != c.wantOwner {
+			t.Errorf("ParseBill(newBill(%v)) owner == %s, want %s", c.deviceIds, b.OwnerByID(c.want[0]), c.wantOwner)
+		}
+	}
+}
+
+func TestRenderWarnings(t *testing.T) {
+	warnings := []tingbill.Warning{
+		{Code: "csv-empty", Severity: tingbill.SeverityWarning, Message: "messages csv file is empty", Context: map[string]string{"file": "messages"}},
+		{Code: "remainder-cents", Severity: tingbill.SeverityInfo, Message: "leftover cents"},
+	}
+
+	cases := []struct {
+		verbosity string
+		want      string
+	}{
+		{verbosityQuiet, ""},
+		{verbosityNormal, "warning [csv-empty]: messages csv file is empty (file=messages)\n"},
+		{verbosityVerbose, "warning [csv-empty]: messages csv file is empty (file=messages)\ninfo [remainder-cents]: leftover cents\n"},
+		{verbosityJSON, `[
+  {
+    "code": "csv-empty",
+    "severity": "warning",
+    "message": "messages csv file is empty",
+    "context": {
+      "file": "messages"
+    }
+  },
+  {
+    "code": "remainder-cents",
+    "severity": "info",
+    "message": "leftover cents"
+  }
+]
+`},
+	}
+
+	for _, c := range cases {
+		var b strings.Builder
+		if err := renderWarnings(&b, warnings, c.verbosity); err != nil {
+			t.Errorf("renderWarnings(%s) err, %v", c.verbosity, err)
+		}
+
+		if got := b.String(); got != c.want {
+			t.Errorf("renderWarnings(%s) == %q, want %q", c.verbosity, got, c.want)
+		}
+	}
+}
+
+func TestPrintBadRows(t *testing.T) {
+	warnings := []tingbill.Warning{
+		{Code: "csv-empty", Severity: tingbill.SeverityWarning, Message: "messages csv file is empty"},
+		{Code: tingparse.WarnBadRow, Severity: tingbill.SeverityWarning, Message: `minutes.csv line 3, column "Duration (min)": "1.5" isn't a whole number`},
+	}
+
+	cases := []struct {
+		warnings  []tingbill.Warning
+		verbosity string
+		want      string
+	}{
+		{warnings, verbosityQuiet, "Skipped 1 bad rows in the csv files, their usage isn't in the split:\n  minutes.csv line 3, column \"Duration (min)\": \"1.5\" isn't a whole number\n\n"},
+		{warnings, verbosityJSON, ""},
+		{warnings[:1], verbosityNormal, ""},
+	}
+
+	for _, c := range cases {
+		var b strings.Builder
+		printBadRows(&b, c.warnings, c.verbosity)
+
+		if got := b.String(); got != c.want {
+			t.Errorf("printBadRows(%s) == %q, want %q", c.verbosity, got, c.want)
+		}
+	}
+}
+
+func TestJSONVerbosity(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"bill.toml", "minutes.csv", "messages.csv", "megabytes.csv"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "..", "test", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commands := []struct {
+		name string
+		run  func(w io.Writer)
+	}{
+		{"dir", func(w io.Writer) { parseDir(w, dir, tingpdf.Options{}, verbosityJSON, false) }},
+		{"validate", func(w io.Writer) { validateDir(w, dir, verbosityJSON, false) }},
+		{"explain", func(w io.Writer) { explainDir(w, dir, "owner1", verbosityJSON, false) }},
+	}
+
+	for _, c := range commands {
+		var b strings.Builder
+		c.run(&b)
+
+		var warnings []tingbill.Warning
+		if err := json.Unmarshal([]byte(b.String()), &warnings); err != nil {
+			t.Errorf("%s with json verbosity wrote %q, which isn't JSON, %v", c.name, b.String(), err)
+		}
+	}
+}
+
+func TestCalculateDirDescription(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "2019-09-ting")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither a description, nor dates in the usage csv files to make one from
+	files := map[string]string{
+		"bill.toml": `total = 10.00
+minutes = 10.00
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`,
+		"minutes.csv":   "Phone,Duration (min)\n1112223333,2",
+		"messages.csv":  "Phone\n1112223333",
+		"megabytes.csv": "Device,Kilobytes\n1112223333,100",
+	}
+
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	billData, _, err := calculateDir(dir, false, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("calculateDir(%s) err, %v", dir, err)
+	}
+
+	if want := "2019-09-ting"; billData.Description != want {
+		t.Errorf("calculateDir(%s) Description == %q, want %q", dir, billData.Description, want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/hitjim/ting-bill-split/internal/tingparse"
+)
+
+// Verbosity levels for the `-verbosity` flag, which controls how warnings are shown.
+const (
+	// verbosityQuiet hides every warning.
+	verbosityQuiet = "quiet"
+	// verbosityNormal shows warnings as text, but hides info-level ones. This is the default.
+	verbosityNormal = "normal"
+	// verbosityVerbose shows every warning as text.
+	verbosityVerbose = "verbose"
+	// verbosityJSON shows every warning as a JSON array, for use by other tools.
+	verbosityJSON = "json"
+)
+
+func validVerbosity(v string) bool {
+	return v == verbosityQuiet || v == verbosityNormal || v == verbosityVerbose || v == verbosityJSON
+}
+
+// renderWarnings writes warnings to w, as text or JSON depending on verbosity.
+func renderWarnings(w io.Writer, warnings []tingbill.Warning, verbosity string) error {
+	switch verbosity {
+	case verbosityQuiet:
+		return nil
+	case verbosityJSON:
+		if warnings == nil {
+			warnings = []tingbill.Warning{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(warnings)
+	}
+
+	for _, warning := range warnings {
+		if verbosity != verbosityVerbose && warning.Severity == tingbill.SeverityInfo {
+			continue
+		}
+
+		if _, err := fmt.Fprintln(w, warning); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// messageWriter returns where to write everything but the warnings, like progress and reports.
+// That's w, except with json verbosity, where it's stderr so w only has the JSON.
+func messageWriter(w io.Writer, verbosity string) io.Writer {
+	if verbosity == verbosityJSON {
+		return os.Stderr
+	}
+
+	return w
+}
+
+// printBadRows writes a summary of the bad rows skipped by the `-lenient` flag to w, so they
+// aren't lost among the other warnings. JSON output already has them, so it's left alone.
+func printBadRows(w io.Writer, warnings []tingbill.Warning, verbosity string) {
+	if verbosity == verbosityJSON {
+		return
+	}
+
+	var bad []tingbill.Warning
+	for _, warning := range warnings {
+		if warning.Code == tingparse.WarnBadRow {
+			bad = append(bad, warning)
+		}
+	}
+
+	if len(bad) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Skipped %d bad rows in the csv files, their usage isn't in the split:\n", len(bad))
+	for _, warning := range bad {
+		fmt.Fprintf(w, "  %s\n", warning.Message)
+	}
+	fmt.Fprintln(w)
+}
+
+// lenientHint adds a suggestion to use the `-lenient` flag to a bad row error.
+func lenientHint(err error) error {
+	var pe *tingparse.ParseError
+	if errors.As(err, &pe) {
+		return fmt.Errorf("%w\nFix the row, or run with -lenient to skip bad rows", err)
+	}
+
+	return err
+}
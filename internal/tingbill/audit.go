@@ -0,0 +1,123 @@
+package tingbill
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// AuditStep explains how a single cost from the Bill was split onto one device.
+// Item names the cost, like "Minutes" or `Charge "Hotspot"`. Amount is the whole cost being
+// split, and Strategy is the allocation strategy used. Usage and TotalUsage are only set when
+// UsageBased is true. Weight out of TotalWeight gives Percent, the device's part of Amount.
+// Exact is the device's share before rounding, Rounded is Exact rounded toward zero to the cent,
+// and Adjustment is any leftover cents the remainder policy handed to the device. Share is what
+// the device actually pays for the cost, and is always Rounded plus Adjustment.
+type AuditStep struct {
+	Item        string
+	Strategy    string
+	Amount      decimal.Decimal
+	UsageBased  bool
+	Usage       decimal.Decimal
+	TotalUsage  decimal.Decimal
+	Weight      decimal.Decimal
+	TotalWeight decimal.Decimal
+	Percent     decimal.Decimal
+	Exact       decimal.Decimal
+	Rounded     decimal.Decimal
+	Adjustment  decimal.Decimal
+	Share       decimal.Decimal
+}
+
+// Lines returns the AuditStep as human-readable lines of text, one calculation per line.
+func (s AuditStep) Lines() []string {
+	lines := []string{fmt.Sprintf("%s - $%s split by %s", s.Item, s.Amount.StringFixed(2), s.Strategy)}
+
+	if s.UsageBased {
+		lines = append(lines, fmt.Sprintf("  usage %s of %s total", s.Usage, s.TotalUsage))
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("  weight %s of %s = %s%%", s.Weight.Round(6), s.TotalWeight.Round(6), s.Percent.StringFixed(4)),
+		fmt.Sprintf("  $%s x %s%% = $%s, rounded to $%s", s.Amount.StringFixed(2), s.Percent.StringFixed(4), s.Exact.StringFixed(6), s.Rounded.StringFixed(2)),
+	)
+
+	if !s.Adjustment.IsZero() {
+		lines = append(lines, fmt.Sprintf("  %s$%s leftover from rounding", sign(s.Adjustment), s.Adjustment.Abs().StringFixed(2)))
+	}
+
+	lines = append(lines, fmt.Sprintf("  share $%s", s.Share.StringFixed(2)))
+
+	return lines
+}
+
+// Explain returns every step of the calculation for a device or owner on the Bill, as
+// human-readable lines of text. who may be a deviceId or an owner. b should be the same Bill
+// that generated the BillSplit. A deviceId may be written any way NormalizePhone accepts.
+func (bs BillSplit) Explain(b Bill, who string) ([]string, error) {
+	deviceID := who
+	if n, err := NormalizePhone(who); err == nil {
+		deviceID = n
+	}
+
+	for _, id := range b.DeviceIds() {
+		if id == deviceID {
+			return bs.explainDevice(b, id), nil
+		}
+	}
+
+	ids := b.DeviceIdsByOwner(who)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%s is not a deviceId or owner on the bill", who)
+	}
+
+	var lines []string
+	total := decimal.Zero
+
+	for _, id := range ids {
+		lines = append(lines, bs.explainDevice(b, id)...)
+		lines = append(lines, "")
+		total = total.Add(bs.DeviceTotal(id))
+	}
+
+	lines = append(lines, fmt.Sprintf("Total for %s, %d lines: $%s", who, len(ids), total.StringFixed(2)))
+
+	return lines, nil
+}
+
+// explainDevice returns every step of the calculation for a single device.
+func (bs BillSplit) explainDevice(b Bill, id string) []string {
+	lines := []string{fmt.Sprintf("Phone number %s, owned by %s", id, b.OwnerByID(id))}
+
+	if f, ok := bs.Proration[id]; ok && !f.Equal(decimal.New(1, 0)) {
+		lines = append(lines, fmt.Sprintf("Active for %s%% of the billing period, which scales its shared costs", f.Mul(decimal.New(100, 0)).StringFixed(2)))
+	}
+
+	for _, s := range bs.Audit[id] {
+		lines = append(lines, s.Lines()...)
+	}
+
+	lines = append(lines, fmt.Sprintf("Total: $%s", bs.DeviceTotal(id).StringFixed(2)))
+
+	// Only mention payers when someone other than the owner pays for the device
+	for _, d := range b.Devices {
+		if d.DeviceID != id || len(d.Payers) == 0 {
+			continue
+		}
+
+		for _, payer := range d.Payers.Keys() {
+			lines = append(lines, fmt.Sprintf("  paid by %s: $%s", payer, bs.PayerCosts[payer][id].StringFixed(2)))
+		}
+	}
+
+	return lines
+}
+
+// sign returns "+" for positive amounts and "-" for negative ones.
+func sign(d decimal.Decimal) string {
+	if d.IsNegative() {
+		return "-"
+	}
+
+	return "+"
+}
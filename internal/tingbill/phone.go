@@ -0,0 +1,46 @@
+package tingbill
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizePhone returns the canonical form of a US phone number, which is its 10 digits, like
+// "1112223333". It accepts the usual ways of writing one, like "111-222-3333", "(111) 222-3333",
+// "111.222.3333" or "+1 111 222 3333". Anything else, like letters, a country code other than
+// +1, or the wrong number of digits, is an error.
+func NormalizePhone(phone string) (string, error) {
+	s := strings.TrimSpace(phone)
+	if s == "" {
+		return "", fmt.Errorf("phone number is empty")
+	}
+
+	international := strings.HasPrefix(s, "+")
+	if international {
+		s = s[1:]
+	}
+
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("%q isn't a phone number, it can only have digits, spaces, dashes, dots, parentheses and a leading +", phone)
+		}
+	}
+
+	d := digits.String()
+
+	switch {
+	case international && !strings.HasPrefix(d, "1"):
+		return "", fmt.Errorf("%q isn't a US phone number, only the +1 country code is supported", phone)
+	case len(d) == 11 && strings.HasPrefix(d, "1"):
+		d = d[1:]
+	case international || len(d) != 10:
+		return "", fmt.Errorf("%q has %d digits, expected a 10 digit US phone number, optionally starting with 1 or +1", phone, len(d))
+	}
+
+	return d, nil
+}
@@ -1,6 +1,12 @@
 package tingbill
 
-import "github.com/shopspring/decimal"
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 func (b Bill) DeviceIds() []string {
 	deviceIds := make([]string, len(b.Devices))
@@ -12,8 +18,63 @@ func (b Bill) DeviceIds() []string {
 	return deviceIds
 }
 
+// Owners returns every distinct device owner on the Bill, in the order they first appear.
+func (b Bill) Owners() []string {
+	var owners []string
+	seen := make(map[string]bool)
+
+	for _, d := range b.Devices {
+		if !seen[d.Owner] {
+			seen[d.Owner] = true
+			owners = append(owners, d.Owner)
+		}
+	}
+
+	return owners
+}
+
+// Payers returns every distinct payer on the Bill, in the order they first appear.
+// Payers of the same device are in alphabetical order.
+func (b Bill) Payers() []string {
+	var payers []string
+	seen := make(map[string]bool)
+
+	for _, d := range b.Devices {
+		for _, p := range d.PayerShares().Keys() {
+			if !seen[p] {
+				seen[p] = true
+				payers = append(payers, p)
+			}
+		}
+	}
+
+	return payers
+}
+
+// DeviceIdsByOwner returns the deviceIds of every device belonging to owner, in Bill order.
+func (b Bill) DeviceIdsByOwner(owner string) []string {
+	var deviceIds []string
+
+	for _, d := range b.Devices {
+		if d.Owner == owner {
+			deviceIds = append(deviceIds, d.DeviceID)
+		}
+	}
+
+	return deviceIds
+}
+
+// UnknownOwner is the owner of deviceIds which aren't on the Bill.
+const UnknownOwner = "Unknown"
+
+// OwnerByID returns the owner of the device with the phone number id, which can be written in
+// any form NormalizePhone accepts, or UnknownOwner if it isn't on the Bill.
 func (b Bill) OwnerByID(id string) string {
-	o := "Unknown"
+	o := UnknownOwner
+
+	if n, err := NormalizePhone(id); err == nil {
+		id = n
+	}
 
 	for _, d := range b.Devices {
 		if id == d.DeviceID {
@@ -24,41 +85,470 @@ func (b Bill) OwnerByID(id string) string {
 	return o
 }
 
+// Device is a single line on the Ting plan. ActiveFrom and ActiveTo are optional, and only
+// needed if the line was activated or deactivated partway through the billing period.
+// Payers maps who pays for the line to their percentage share, which must add up to 100.
+// Without Payers, the Owner pays for the whole line. The embedded Limits cap or floor what
+// the line pays.
 type Device struct {
-	DeviceID string
-	Owner    string
+	DeviceID   string
+	Owner      string
+	ActiveFrom Date    `toml:"activeFrom"`
+	ActiveTo   Date    `toml:"activeTo"`
+	Payers     Weights `toml:"payers"`
+	Limits
+}
+
+// Limits caps or floors the total a device or owner pays for a Bill. Either one may be nil,
+// meaning there's no limit.
+type Limits struct {
+	Cap   *decimal.Decimal `toml:"cap"`
+	Floor *decimal.Decimal `toml:"floor"`
+}
+
+// IsSet returns true if there's a cap or a floor.
+func (l Limits) IsSet() bool {
+	return l.Cap != nil || l.Floor != nil
+}
+
+// PayerShares returns the percentage share of each payer for the device, keyed by payer.
+func (d Device) PayerShares() Weights {
+	if len(d.Payers) == 0 {
+		return Weights{d.Owner: decimal.New(100, 0)}
+	}
+
+	return d.Payers
 }
 
-// Used to represent the Ting-provided and user-provided info required to split Bill costs
+// DateLayout is the format for dates in bill.toml, like "2019-09-03".
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date from bill.toml. The zero value means the date wasn't set.
+type Date struct {
+	time.Time
+}
+
+// UnmarshalText accepts a date like "2019-09-03". A full TOML datetime like
+// 2019-09-03T00:00:00Z is accepted too, but only the date is kept.
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := time.Parse(DateLayout, string(text))
+	if err != nil {
+		full, fullErr := time.Parse(time.RFC3339, string(text))
+		if fullErr != nil {
+			return fmt.Errorf("invalid date %q, expected a date like \"2019-09-03\"", text)
+		}
+		t = time.Date(full.Year(), full.Month(), full.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	d.Time = t
+
+	return nil
+}
+
+// MarshalText writes the date like "2019-09-03".
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// String returns the date like "2019-09-03", or an empty string if it isn't set.
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+
+	return d.Format(DateLayout)
+}
+
+// Used to represent the Ting-provided and user-provided info required to split Bill costs.
+// All money fields are US Dollar amounts.
 type Bill struct {
-	Description    string   `toml:"description"`
-	Devices        []Device `toml:"devices"`
-	ShortStrawID   string   `toml:"shortStrawId"`
-	Total          float64  `toml:"total"`
-	DevicesCost    float64  `toml:"devicesCost"`
-	Minutes        float64  `toml:"minutes"`
-	Messages       float64  `toml:"messages"`
-	Megabytes      float64  `toml:"megabytes"`
-	ExtraMinutes   float64  `toml:"extraMinutes"`
-	ExtraMessages  float64  `toml:"extraMessages"`
-	ExtraMegabytes float64  `toml:"extraMegabytes"`
-	Fees           float64  `toml:"fees"`
+	Description    string          `toml:"description"`
+	Devices        []Device        `toml:"devices"`
+	ShortStrawID   string          `toml:"shortStrawId"`
+	Total          decimal.Decimal `toml:"total"`
+	DevicesCost    decimal.Decimal `toml:"devicesCost"`
+	Minutes        decimal.Decimal `toml:"minutes"`
+	Messages       decimal.Decimal `toml:"messages"`
+	Megabytes      decimal.Decimal `toml:"megabytes"`
+	ExtraMinutes   decimal.Decimal `toml:"extraMinutes"`
+	ExtraMessages  decimal.Decimal `toml:"extraMessages"`
+	ExtraMegabytes decimal.Decimal `toml:"extraMegabytes"`
+	Fees           decimal.Decimal `toml:"fees"`
+
+	// PeriodStart and PeriodEnd are the first and last days of the billing period. They're
+	// optional, but required to prorate devices which weren't active for the whole period.
+	PeriodStart Date `toml:"periodStart"`
+	PeriodEnd   Date `toml:"periodEnd"`
+
+	// RemainderPolicy decides who receives leftover cents when a cost can't be split evenly.
+	// Empty uses the default, see tingparse.RemainderLargest.
+	RemainderPolicy string `toml:"remainderPolicy"`
+
+	// ZeroUsagePolicy decides how a usage category's cost is split when nobody used any of it.
+	// Empty uses the default, see tingparse.ZeroUsageEven.
+	ZeroUsagePolicy string `toml:"zeroUsagePolicy"`
+
+	Split SplitPolicies `toml:"split"`
+
+	// Charges are any itemized costs on the Ting bill not covered by the fields above
+	Charges []Charge `toml:"charges"`
+
+	// Credits are referral credits, service credits or refunds on the Ting bill. Their amounts
+	// are positive, and are subtracted from what devices owe.
+	Credits []Charge `toml:"credits"`
+
+	// OwnerLimits caps or floors the total paid for all of an owner's devices, keyed by owner.
+	OwnerLimits map[string]Limits `toml:"owners"`
+
+	// FloorDevicesShare sets a floor for every device, so it pays at least its share of
+	// DevicesCost, no matter what caps or credits apply to it.
+	FloorDevicesShare bool `toml:"floorDevicesShare"`
+
+	// SurchargesFrom names the shared cost the surcharges from the usage csv files are included
+	// in on the Ting bill, so they can be taken out of it. Empty uses the default, see
+	// tingparse.SurchargesFromFees.
+	SurchargesFrom string `toml:"surchargesFrom"`
+
+	// Counting decides which directions of minutes and messages count as a device's usage.
+	Counting CountingPolicies `toml:"counting"`
+
+	// International prices roaming and international usage, which is only paid for by the
+	// devices that used it.
+	International InternationalPolicy `toml:"international"`
+
+	// NetworkWeights scales the data used on each network type, like "3G" or "4G LTE", before
+	// it's used to split data costs, keyed by network type. Types it doesn't list have a
+	// weight of 1, and a weight of 0 leaves that type out of the split.
+	NetworkWeights Weights `toml:"networkWeights"`
+
+	// UnknownDevices decides what happens to usage in the csv files for deviceIds which aren't
+	// in Devices. Empty uses the default, see tingparse.UnknownDevicesIgnore.
+	UnknownDevices string `toml:"unknownDevices"`
+}
+
+// NetworkWeight returns the weight of data used on network type t, which is 1 unless the Bill's
+// NetworkWeights says otherwise.
+func (b Bill) NetworkWeight(t string) decimal.Decimal {
+	if w, ok := b.NetworkWeights[t]; ok {
+		return w
+	}
+
+	return decimal.New(1, 0)
+}
+
+// CountingPolicies holds a CountingPolicy for the usage categories which have a direction.
+type CountingPolicies struct {
+	Minutes  CountingPolicy `toml:"minutes"`
+	Messages CountingPolicy `toml:"messages"`
+}
+
+// CountingPolicy decides which directions of usage count towards a device's share of a usage
+// category. Policy names one of the counting policies in tingparse, like "outgoing". Outgoing
+// and Incoming are only used by "weighted", and are how much each direction counts for.
+type CountingPolicy struct {
+	Policy   string          `toml:"policy"`
+	Outgoing decimal.Decimal `toml:"outgoing"`
+	Incoming decimal.Decimal `toml:"incoming"`
+}
+
+// InternationalPolicy prices roaming and international minutes and messages. Each category
+// either has a per-unit rate, like MinuteRate, which is taken out of the Bill's Minutes or
+// Messages, or an amount from its own line on the Ting bill, like Minutes. HomeCountries are the
+// countries which aren't international, the United States when it's empty.
+type InternationalPolicy struct {
+	MinuteRate    decimal.Decimal `toml:"minuteRate"`
+	MessageRate   decimal.Decimal `toml:"messageRate"`
+	Minutes       decimal.Decimal `toml:"minutes"`
+	Messages      decimal.Decimal `toml:"messages"`
+	HomeCountries []string        `toml:"homeCountries"`
+}
+
+// Charge is an itemized cost from the Ting bill, like a hotspot add-on or a one-off charge.
+// Category is the usage category the charge belongs to, which decides what usage data a
+// proportional split is based on. The embedded SplitPolicy decides how it's split.
+// If DeviceID is set, like for a hardware installment, the whole charge belongs to that
+// device and isn't split at all. If Owner is set, it's only split between that owner's devices.
+type Charge struct {
+	Name     string          `toml:"name"`
+	Amount   decimal.Decimal `toml:"amount"`
+	Category string          `toml:"category"`
+	DeviceID string          `toml:"deviceId"`
+	Owner    string          `toml:"owner"`
+	SplitPolicy
+}
+
+// SplitPolicy selects how a single cost category is split between devices. Strategy names one
+// of the allocation strategies in tingparse. EvenPercent is only used by "hybrid", Weights
+// (keyed by deviceId) only by "weighted", Tiers only by "tiered" and "shapley", and Samples
+// only by "shapley".
+type SplitPolicy struct {
+	Strategy    string          `toml:"strategy"`
+	EvenPercent decimal.Decimal `toml:"evenPercent"`
+	Weights     Weights         `toml:"weights"`
+	Tiers       []Tier          `toml:"tiers"`
+	Samples     int             `toml:"samples"`
+}
+
+// Tier is one of Ting's usage buckets for a category. Usage up to UpTo costs Cost in total.
+// UpTo is in the same units as the usage - minutes, messages, or kilobytes.
+type Tier struct {
+	UpTo int             `toml:"upTo"`
+	Cost decimal.Decimal `toml:"cost"`
+}
+
+// Weights maps keys, like deviceIds or payers, to a number such as a relative weight or a percentage.
+type Weights map[string]decimal.Decimal
+
+// UnmarshalTOML decodes a TOML table of key = number. It's needed because a plain map
+// can't hold a mix of TOML integers and floats, like `{ 1112223333 = 2, 1112224444 = 0.5 }`.
+func (w *Weights) UnmarshalTOML(data interface{}) error {
+	table, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a table like { 1112223333 = 2 }, got %v", data)
+	}
+
+	*w = make(Weights)
+
+	for id, v := range table {
+		switch n := v.(type) {
+		case int64:
+			(*w)[id] = decimal.New(n, 0)
+		case float64:
+			(*w)[id] = decimal.NewFromFloat(n)
+		default:
+			return fmt.Errorf("value for %s must be a number, got %v", id, v)
+		}
+	}
+
+	return nil
+}
+
+// Keys returns every key in alphabetical order.
+func (w Weights) Keys() []string {
+	keys := make([]string, 0, len(w))
+
+	for k := range w {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// SplitPolicies holds a SplitPolicy for each cost category on the Bill. An empty policy keeps
+// the default behavior - usage categories are split proportionally, the rest evenly.
+type SplitPolicies struct {
+	Minutes   SplitPolicy `toml:"minutes"`
+	Messages  SplitPolicy `toml:"messages"`
+	Megabytes SplitPolicy `toml:"megabytes"`
+	Devices   SplitPolicy `toml:"devices"`
+	Fees      SplitPolicy `toml:"fees"`
 }
 
 // Used to contain all subtotals for a monthly Bill.
-// MinuteCosts, MessageCosts, MegabyteCosts are maps of decimal.Decimal totals.
+// MinuteCosts, MessageCosts, MegabyteCosts are maps of decimal.Decimal totals, rounded to the cent.
 // They are split by Bill.Devices and calculated by usage in parseMaps.
+// MegabyteQty is the data each device used in KB. MegabyteTypeQty breaks it down by network type,
+// keyed by deviceId then type, and MegabyteWeightedQty is the usage after the Bill's
+// NetworkWeights are applied, which MegabyteCosts and MegabytePercent are based on.
 // SharedCosts reflect the rest of the items not based on usage, which get split evenly across all DeviceIds
+// MinuteQty and MessageQty are the usage counted by the Bill's counting policies, which the costs
+// are split by. They're fractional when a weighted counting policy has fractional weights.
+// MinuteOutQty, MinuteInQty, MessageOutQty and MessageInQty are the usage in each direction,
+// keyed by deviceId, where sent messages are outgoing.
+// InternationalMinuteQty and InternationalMessageQty are the roaming and international minutes and
+// messages each device used, and InternationalMinuteCosts and InternationalMessageCosts are what
+// each device pays for them, which is included in MinuteCosts and MessageCosts.
+// InternationalCountries lists the countries each device roamed in or contacted, sorted. All of
+// them are keyed by deviceId.
+// SurchargeCosts are the surcharges from the usage csv files, keyed by deviceId. Each device
+// pays its own, and they're taken out of the shared pool named by Bill.SurchargesFrom first.
+// Proration is the fraction of the billing period each device was active, which scales its SharedCosts.
+// OwnerCosts rolls every device's costs up to its owner, keyed by Device.Owner.
+// PayerCosts is what each payer pays for each device, keyed by payer, then deviceId.
+// Audit has every step of the calculation for each device, keyed by deviceId, in the order
+// the costs were split.
+// Warnings are any diagnostics from the calculation, which don't stop it.
+// ZeroUsage lists every cost which had no usage to split by, and the policy used instead.
+// LimitCosts are the adjustments from caps and floors, keyed by deviceId. They're negative for
+// capped devices, and positive for the devices which made up the difference.
+// Limits lists every cap and floor that was applied, in the order they were applied.
+// AddedDevices are the devices with usage in the csv files, but not on the Bill, which were
+// added to the split with the UnknownOwner, by Bill.UnknownDevices. Add them to the Bill's
+// Devices before generating reports.
 // TODO: finish these comments
 type BillSplit struct {
-	MinuteCosts     map[string]decimal.Decimal
-	MinuteQty       map[string]int
-	MinutePercent   map[string]decimal.Decimal
-	MessageCosts    map[string]decimal.Decimal
-	MessageQty      map[string]int
-	MessagePercent  map[string]decimal.Decimal
-	MegabyteCosts   map[string]decimal.Decimal
-	MegabyteQty     map[string]int
-	MegabytePercent map[string]decimal.Decimal
-	SharedCosts     map[string]decimal.Decimal
+	MinuteCosts         map[string]decimal.Decimal
+	MinuteQty           map[string]decimal.Decimal
+	MinutePercent       map[string]decimal.Decimal
+	MessageCosts        map[string]decimal.Decimal
+	MessageQty          map[string]decimal.Decimal
+	MessagePercent      map[string]decimal.Decimal
+	MegabyteCosts       map[string]decimal.Decimal
+	MegabyteQty         map[string]int
+	MegabytePercent     map[string]decimal.Decimal
+	MegabyteTypeQty     map[string]map[string]int
+	MegabyteWeightedQty map[string]int
+	SharedCosts         map[string]decimal.Decimal
+	SurchargeCosts      map[string]decimal.Decimal
+	Charges             []ChargeSplit
+	Credits             []ChargeSplit
+	Proration           map[string]decimal.Decimal
+	OwnerCosts          map[string]OwnerSplit
+	PayerCosts          map[string]map[string]decimal.Decimal
+	Audit               map[string][]AuditStep
+	Warnings            []Warning
+	ZeroUsage           []ZeroUsageSplit
+	LimitCosts          map[string]decimal.Decimal
+	Limits              []LimitSplit
+
+	InternationalMinuteQty    map[string]int
+	InternationalMessageQty   map[string]int
+	InternationalMinuteCosts  map[string]decimal.Decimal
+	InternationalMessageCosts map[string]decimal.Decimal
+	InternationalCountries    map[string][]string
+
+	MinuteOutQty  map[string]int
+	MinuteInQty   map[string]int
+	MessageOutQty map[string]int
+	MessageInQty  map[string]int
+
+	AddedDevices []Device
+}
+
+// NetworkTypes returns every network type any device used data on, sorted. Data without a
+// network type is left out.
+func (bs BillSplit) NetworkTypes() []string {
+	seen := make(map[string]bool)
+	var types []string
+
+	for _, byType := range bs.MegabyteTypeQty {
+		for t := range byType {
+			if t != "" && !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// LimitSplit records a cap or floor applied to a device or owner. Target is the deviceId, or the
+// owner if IsOwner is true. Kind is "cap" or "floor". Before is what Target would have paid,
+// and Adjustment is what was added or taken off to meet Limit. The opposite of Adjustment
+// was split between the devices which didn't have a limit applied.
+type LimitSplit struct {
+	Target     string
+	IsOwner    bool
+	Kind       string
+	Limit      decimal.Decimal
+	Before     decimal.Decimal
+	Adjustment decimal.Decimal
+}
+
+// ZeroUsageSplit records a cost based on usage which nobody used any of, like the messages cost
+// in a month without messages. Item names the cost, and Policy is the zero usage policy used
+// to split its Amount instead.
+type ZeroUsageSplit struct {
+	Item   string
+	Policy string
+	Amount decimal.Decimal
+}
+
+// MovedToShared returns true if the cost was moved into the shared costs by the "shared" policy.
+func (z ZeroUsageSplit) MovedToShared() bool {
+	return z.Policy == "shared"
+}
+
+// PayerTotal returns the total amount payer pays for the Bill, across every device.
+func (bs BillSplit) PayerTotal(payer string) decimal.Decimal {
+	total := decimal.Zero
+
+	for _, v := range bs.PayerCosts[payer] {
+		total = total.Add(v)
+	}
+
+	return total
+}
+
+// OwnerSplit contains the costs of every device belonging to a single owner, summed by category.
+// Total is the amount the owner actually pays.
+type OwnerSplit struct {
+	DeviceIDs      []string
+	MinuteCosts    decimal.Decimal
+	MessageCosts   decimal.Decimal
+	MegabyteCosts  decimal.Decimal
+	SharedCosts    decimal.Decimal
+	SurchargeCosts decimal.Decimal
+	ChargeCosts    decimal.Decimal
+	DeviceCharges  decimal.Decimal
+	CreditCosts    decimal.Decimal
+	LimitCosts     decimal.Decimal
+	Total          decimal.Decimal
+}
+
+// ChargeSplit contains the split of a single Charge or credit from the Bill. Strategy is the
+// name of the allocation strategy actually used. Amount and Costs are negative for credits.
+// Costs are keyed by deviceId, and only include the devices which took part in the split.
+// DeviceID and Owner are only set for charges attached to a single device or owner.
+type ChargeSplit struct {
+	Name     string
+	Category string
+	Strategy string
+	DeviceID string
+	Owner    string
+	Amount   decimal.Decimal
+	Costs    map[string]decimal.Decimal
+}
+
+// Includes returns true if device id took part in the split.
+func (c ChargeSplit) Includes(id string) bool {
+	_, ok := c.Costs[id]
+	return ok
+}
+
+// ChargeTotal returns the sum of every itemized Charge split to device id, not counting
+// charges attached to a single device.
+func (bs BillSplit) ChargeTotal(id string) decimal.Decimal {
+	total := decimal.Zero
+
+	for _, c := range bs.Charges {
+		if c.DeviceID == "" {
+			total = total.Add(c.Costs[id])
+		}
+	}
+
+	return total
+}
+
+// DeviceChargeTotal returns the sum of every Charge attached directly to device id.
+func (bs BillSplit) DeviceChargeTotal(id string) decimal.Decimal {
+	total := decimal.Zero
+
+	for _, c := range bs.Charges {
+		if c.DeviceID == id {
+			total = total.Add(c.Costs[id])
+		}
+	}
+
+	return total
+}
+
+// CreditTotal returns the sum of every credit applied to device id. It's negative or zero.
+func (bs BillSplit) CreditTotal(id string) decimal.Decimal {
+	total := decimal.Zero
+
+	for _, c := range bs.Credits {
+		total = total.Add(c.Costs[id])
+	}
+
+	return total
+}
+
+// DeviceTotal returns the total amount device id owes for the Bill.
+func (bs BillSplit) DeviceTotal(id string) decimal.Decimal {
+	return decimal.Sum(bs.MinuteCosts[id], bs.MessageCosts[id], bs.MegabyteCosts[id], bs.SharedCosts[id],
+		bs.SurchargeCosts[id], bs.ChargeTotal(id), bs.DeviceChargeTotal(id), bs.CreditTotal(id), bs.LimitCosts[id])
 }
@@ -3,12 +3,18 @@ package tingbill
 import (
 	"fmt"
 	"testing"
+
+	"github.com/shopspring/decimal"
 )
 
 func TestBillOwnerByID(t *testing.T) {
 	b := Bill{}
 
 	t.Run("Handle empty id", testBillOwnerByIDFunc(b, "", "Unknown"))
+
+	b = Bill{Devices: []Device{{DeviceID: "1112223333", Owner: "owner1"}}}
+
+	t.Run("Handle formatted id", testBillOwnerByIDFunc(b, "(111) 222-3333", "owner1"))
 }
 
 func testBillOwnerByIDFunc(b Bill, id string, expected string) func(*testing.T) {
@@ -19,3 +25,130 @@ func testBillOwnerByIDFunc(b Bill, id string, expected string) func(*testing.T)
 		}
 	}
 }
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		phone   string
+		want    string
+		wantErr bool
+	}{
+		{"1112223333", "1112223333", false},
+		{"111-222-3333", "1112223333", false},
+		{"(111) 222-3333", "1112223333", false},
+		{"111.222.3333", "1112223333", false},
+		{"+1 111 222 3333", "1112223333", false},
+		{"1-111-222-3333", "1112223333", false},
+		{" 1112223333 ", "1112223333", false},
+		{"", "", true},
+		{"111-222-333", "", true},
+		{"+44 20 7946 0958", "", true},
+		{"21112223333", "", true},
+		{"111-CALL-NOW", "", true},
+		{"+1 222 3333", "", true},
+	}
+
+	for _, c := range cases {
+		got, err := NormalizePhone(c.phone)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("NormalizePhone(%q) == %q, expected an error", c.phone, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("NormalizePhone(%q) err, %v", c.phone, err)
+		} else if got != c.want {
+			t.Errorf("NormalizePhone(%q) == %q, want %q", c.phone, got, c.want)
+		}
+	}
+}
+
+func TestBillSplitDeviceTotal(t *testing.T) {
+	bs := BillSplit{
+		MinuteCosts:   map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(1.10)},
+		MessageCosts:  map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(2.20)},
+		MegabyteCosts: map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(3.30)},
+		SharedCosts:   map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(4.40)},
+		Charges: []ChargeSplit{
+			{Name: "one", Costs: map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(0.50)}},
+			{Name: "two", Costs: map[string]decimal.Decimal{"1112224444": decimal.NewFromFloat(9.99)}},
+		},
+	}
+
+	want := decimal.NewFromFloat(11.50)
+	if got := bs.DeviceTotal("1112223333"); !got.Equal(want) {
+		t.Errorf("DeviceTotal(1112223333) == %v, want %v", got, want)
+	}
+}
+
+func TestBillOwners(t *testing.T) {
+	b := Bill{
+		Devices: []Device{
+			{DeviceID: "1112223333", Owner: "owner1"},
+			{DeviceID: "1112224444", Owner: "owner2"},
+			{DeviceID: "1112220000", Owner: "owner1"},
+		},
+	}
+
+	want := []string{"owner1", "owner2"}
+	if got := b.Owners(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Owners() == %v, want %v", got, want)
+	}
+
+	wantIds := []string{"1112223333", "1112220000"}
+	if got := b.DeviceIdsByOwner("owner1"); fmt.Sprint(got) != fmt.Sprint(wantIds) {
+		t.Errorf("DeviceIdsByOwner(owner1) == %v, want %v", got, wantIds)
+	}
+}
+
+func TestBillSplitExplain(t *testing.T) {
+	b := Bill{
+		Devices: []Device{
+			{DeviceID: "1112223333", Owner: "owner1"},
+			{DeviceID: "1112224444", Owner: "owner1"},
+		},
+	}
+
+	bs := BillSplit{
+		MinuteCosts: map[string]decimal.Decimal{
+			"1112223333": decimal.NewFromFloat(1.11),
+			"1112224444": decimal.NewFromFloat(2.22),
+		},
+		Audit: map[string][]AuditStep{
+			"1112223333": {{Item: "Minutes", Share: decimal.NewFromFloat(1.11)}},
+			"1112224444": {{Item: "Minutes", Share: decimal.NewFromFloat(2.22)}},
+		},
+	}
+
+	got, err := bs.Explain(b, "1112224444")
+	if err != nil {
+		t.Fatalf("Explain(1112224444) err, %v", err)
+	}
+
+	if want := "Total: $2.22"; got[len(got)-1] != want {
+		t.Errorf("Explain(1112224444) last line == %q, want %q", got[len(got)-1], want)
+	}
+
+	got, err = bs.Explain(b, "111-222-4444")
+	if err != nil {
+		t.Fatalf("Explain(111-222-4444) err, %v", err)
+	}
+
+	if want := "Total: $2.22"; got[len(got)-1] != want {
+		t.Errorf("Explain(111-222-4444) last line == %q, want %q", got[len(got)-1], want)
+	}
+
+	got, err = bs.Explain(b, "owner1")
+	if err != nil {
+		t.Fatalf("Explain(owner1) err, %v", err)
+	}
+
+	if want := "Total for owner1, 2 lines: $3.33"; got[len(got)-1] != want {
+		t.Errorf("Explain(owner1) last line == %q, want %q", got[len(got)-1], want)
+	}
+
+	if _, err := bs.Explain(b, "nobody"); err == nil {
+		t.Errorf("Explain(nobody) err == nil, want an error")
+	}
+}
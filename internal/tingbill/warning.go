@@ -0,0 +1,47 @@
+package tingbill
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity levels of a Warning, from least to most serious.
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+)
+
+// Warning is a diagnostic produced while parsing usage or splitting a Bill. Warnings never stop
+// the calculation, they're returned alongside the results for the caller to show or ignore.
+// Code is a short, stable identifier like "csv-empty", Severity is one of the Severity levels,
+// and Context holds details like the file or deviceId involved.
+type Warning struct {
+	Code     string            `json:"code"`
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Context  map[string]string `json:"context,omitempty"`
+}
+
+// String returns the Warning as a single line of text, like
+// "warning [csv-empty]: minutes csv file is empty (file=minutes)".
+func (w Warning) String() string {
+	s := fmt.Sprintf("%s [%s]: %s", w.Severity, w.Code, w.Message)
+
+	if len(w.Context) == 0 {
+		return s
+	}
+
+	keys := make([]string, 0, len(w.Context))
+	for k := range w.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + w.Context[k]
+	}
+
+	return s + " (" + strings.Join(pairs, ", ") + ")"
+}
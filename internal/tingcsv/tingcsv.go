@@ -2,9 +2,9 @@ package tingcsv
 
 import (
 	"encoding/csv"
-	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/hitjim/ting-bill-split/internal/tingbill"
 	"github.com/shopspring/decimal"
@@ -15,7 +15,6 @@ import (
 // The tingbill.Bill should be the same one that generated the tingbill.BillSplit
 // The first value in a table's header row will **Have Asterisks**
 func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (string, error) {
-	fmt.Printf("\nGenerating invoice CSV...\n")
 	const RoundPrecision = int32(2)
 
 	// Bail right away if we can't write the CSV file
@@ -37,6 +36,8 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	msgCosts := decimal.New(0, 1)
 	megCosts := decimal.New(0, 1)
 	shrCosts := decimal.New(0, 1)
+	chgCosts := decimal.New(0, 1)
+	surCosts := decimal.New(0, 1)
 
 	for _, v := range bs.MinuteCosts {
 		minCosts = minCosts.Add(v)
@@ -51,8 +52,17 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	for _, v := range bs.SharedCosts {
 		shrCosts = shrCosts.Add(v)
 	}
+	for _, v := range bs.SurchargeCosts {
+		surCosts = surCosts.Add(v)
+	}
+	for _, c := range bs.Charges {
+		chgCosts = chgCosts.Add(c.Amount)
+	}
+	for _, c := range bs.Credits {
+		chgCosts = chgCosts.Add(c.Amount)
+	}
 
-	calcCost := decimal.Sum(minCosts, msgCosts, megCosts, shrCosts).Round(RoundPrecision)
+	calcCost := decimal.Sum(minCosts, msgCosts, megCosts, shrCosts, surCosts, chgCosts).Round(RoundPrecision)
 	usgCost := decimal.Sum(minCosts, msgCosts, megCosts).Round(RoundPrecision)
 
 	records := [][]string{
@@ -60,19 +70,21 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		{
 			b.Description,
 			strconv.Itoa(len(b.Devices)),
-			strconv.FormatFloat(b.Total, 'f', 2, 64),
+			b.Total.StringFixed(2),
 			calcCost.StringFixed(2),
 			usgCost.StringFixed(2),
-			strconv.FormatFloat(b.DevicesCost, 'f', 2, 64),
-			strconv.FormatFloat(b.Fees, 'f', 2, 64),
+			b.DevicesCost.StringFixed(2),
+			b.Fees.StringFixed(2),
 		},
 	}
 
-	// Table 1: Usage - 8 columns, <deviceID qty>+1 rows
-	// heading: number, nickname?, min, msg, data (KB), min%, msg%, data%
+	// Table 1: Usage - 13 columns, <deviceID qty>+1 rows
+	// heading: number, nickname?, minutes, min out, min in, messages, msg out, msg in, data (KB),
+	// min%, msg%, data%, active (proration factor). minutes and messages are the usage the counting
+	// policies count, which min% and msg% are shares of. Rows with no direction are only in those.
 	// Then entries for each number
 	// then entry for "Total" under nickname, and rest of sums
-	records = append(records, []string{"**Phone Number**", "Owner", "Minutes", "Messages", "Data (KB)", "Min%", "Msg%", "Data%"})
+	records = append(records, []string{"**Phone Number**", "Owner", "Minutes", "Min Out", "Min In", "Messages", "Msg Out", "Msg In", "Data (KB)", "Min%", "Msg%", "Data%", "Active"})
 
 	// Prep data
 	ids := b.DeviceIds()
@@ -81,15 +93,74 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		records = append(records, []string{
 			id,
 			b.OwnerByID(id),
-			strconv.Itoa(bs.MinuteQty[id]),
-			strconv.Itoa(bs.MessageQty[id]),
+			bs.MinuteQty[id].String(),
+			strconv.Itoa(bs.MinuteOutQty[id]),
+			strconv.Itoa(bs.MinuteInQty[id]),
+			bs.MessageQty[id].String(),
+			strconv.Itoa(bs.MessageOutQty[id]),
+			strconv.Itoa(bs.MessageInQty[id]),
 			strconv.Itoa(bs.MegabyteQty[id]),
 			bs.MinutePercent[id].StringFixed(RoundPrecision),
 			bs.MessagePercent[id].StringFixed(RoundPrecision),
 			bs.MegabytePercent[id].StringFixed(RoundPrecision),
+			bs.Proration[id].StringFixed(RoundPrecision),
 		})
 	}
 
+	// Table 1b: Data by network type - 6 columns, up to <deviceID qty>*<network type qty>+1 rows
+	// heading: number, Nickname, Network, Data (KB), Weight, Weighted (KB)
+	// entry for each network type each number used data on. Data% in the usage table is based
+	// on the weighted data. Only written if the megabytes csv file has network types.
+	if types := bs.NetworkTypes(); len(types) > 0 {
+		records = append(records, []string{"**Phone Number**", "Owner", "Network", "Data (KB)", "Weight", "Weighted (KB)"})
+
+		for _, id := range ids {
+			for _, t := range types {
+				kb, ok := bs.MegabyteTypeQty[id][t]
+				if !ok {
+					continue
+				}
+
+				weight := b.NetworkWeight(t)
+				records = append(records, []string{
+					id,
+					b.OwnerByID(id),
+					t,
+					strconv.Itoa(kb),
+					weight.String(),
+					decimal.New(int64(kb), 0).Mul(weight).Round(0).String(),
+				})
+			}
+		}
+	}
+
+	// Table 1c: Roaming & international - 7 columns, <devices with international usage qty>+1 rows
+	// heading: number, Nickname, Intl Min, Intl Msg, Countries, Min, Msg
+	// entry for each number with roaming or international usage, and what it pays for it, which
+	// is included in its Min and Msg costs. Only written if there was any.
+	var intlIDs []string
+	for _, id := range ids {
+		if bs.InternationalMinuteQty[id] > 0 || bs.InternationalMessageQty[id] > 0 {
+			intlIDs = append(intlIDs, id)
+		}
+	}
+
+	if len(intlIDs) > 0 {
+		records = append(records, []string{"**Roaming & international**", "Owner", "Intl Min", "Intl Msg", "Countries", "$Min", "$Msg"})
+
+		for _, id := range intlIDs {
+			records = append(records, []string{
+				id,
+				b.OwnerByID(id),
+				strconv.Itoa(bs.InternationalMinuteQty[id]),
+				strconv.Itoa(bs.InternationalMessageQty[id]),
+				strings.Join(bs.InternationalCountries[id], ", "),
+				bs.InternationalMinuteCosts[id].StringFixed(2),
+				bs.InternationalMessageCosts[id].StringFixed(2),
+			})
+		}
+	}
+
 	// Table 2: Weighted Cost Type - 4 columns, 4 rows (+1 for cell to right of final column)
 	// heading: Weighted: Minutes, Messages, Data
 	// Base: $x, $y, $z
@@ -97,29 +168,29 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	// Total: etc (sum of Min, Msg, Data gets tacked on as extra cell/col on final row)
 
 	// Prep data
-	totalMin := b.Minutes + b.ExtraMinutes
-	totalMsg := b.Messages + b.ExtraMessages
-	totalMeg := b.Megabytes + b.ExtraMegabytes
-	wTotal := strconv.FormatFloat(totalMin+totalMsg+totalMeg, 'f', 2, 64)
+	totalMin := b.Minutes.Add(b.ExtraMinutes)
+	totalMsg := b.Messages.Add(b.ExtraMessages)
+	totalMeg := b.Megabytes.Add(b.ExtraMegabytes)
+	wTotal := decimal.Sum(totalMin, totalMsg, totalMeg).StringFixed(2)
 
 	records = append(records, []string{"**Weighted**", "Minutes", "Messages", "Data"},
 		[]string{
 			"Base",
-			strconv.FormatFloat(b.Minutes, 'f', 2, 64),
-			strconv.FormatFloat(b.Messages, 'f', 2, 64),
-			strconv.FormatFloat(b.Megabytes, 'f', 2, 64),
+			b.Minutes.StringFixed(2),
+			b.Messages.StringFixed(2),
+			b.Megabytes.StringFixed(2),
 		},
 		[]string{
 			"Extra",
-			strconv.FormatFloat(b.ExtraMinutes, 'f', 2, 64),
-			strconv.FormatFloat(b.ExtraMessages, 'f', 2, 64),
-			strconv.FormatFloat(b.ExtraMegabytes, 'f', 2, 64),
+			b.ExtraMinutes.StringFixed(2),
+			b.ExtraMessages.StringFixed(2),
+			b.ExtraMegabytes.StringFixed(2),
 		},
 		[]string{
 			"Total",
-			strconv.FormatFloat(totalMin, 'f', 2, 64),
-			strconv.FormatFloat(totalMsg, 'f', 2, 64),
-			strconv.FormatFloat(totalMeg, 'f', 2, 64),
+			totalMin.StringFixed(2),
+			totalMsg.StringFixed(2),
+			totalMeg.StringFixed(2),
 			wTotal,
 		},
 	)
@@ -129,31 +200,105 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	// Devices: $
 	// Tax & Reg: $
 	// Total: $
-	sTotal := strconv.FormatFloat(b.DevicesCost+b.Fees, 'f', 2, 64)
+	sTotal := b.DevicesCost.Add(b.Fees)
 
 	records = append(records, []string{"**Shared**", "Amount"},
 		[]string{
 			"Devices",
-			strconv.FormatFloat(b.DevicesCost, 'f', 2, 64),
+			b.DevicesCost.StringFixed(2),
 		},
 		[]string{
 			"Tax & Reg",
-			strconv.FormatFloat(b.Fees, 'f', 2, 64),
-		},
-		[]string{
-			"Total",
-			sTotal,
+			b.Fees.StringFixed(2),
 		},
 	)
 
-	// Table 4: Costs split - 7 columns, <deviceID qty>+1 rows
-	// heading: number, Nickname, Min, Msg, Data, Shared, Total
+	// Usage categories nobody used, moved into the shared costs
+	for _, z := range bs.ZeroUsage {
+		if !z.MovedToShared() {
+			continue
+		}
+
+		sTotal = sTotal.Add(z.Amount)
+		records = append(records, []string{z.Item, z.Amount.StringFixed(2)})
+	}
+
+	records = append(records, []string{"Total", sTotal.StringFixed(2)})
+
+	// Table 3b: No usage - 3 columns, <zero usage qty>+1 rows
+	// heading: No usage, Policy, Amount
+	// entry for each cost nobody used, and the zero usage policy it was split by instead.
+	// Only written if there were any.
+	if len(bs.ZeroUsage) > 0 {
+		records = append(records, []string{"**No usage**", "Policy", "$Amount"})
+
+		for _, z := range bs.ZeroUsage {
+			records = append(records, []string{z.Item, z.Policy, z.Amount.StringFixed(2)})
+		}
+	}
+
+	// Table 3c: Caps and floors - 5 columns, <limits applied qty>+1 rows
+	// heading: Applied to, Kind, Limit, Before, Adjustment
+	// entry for each cap or floor applied, in the order they were applied. The adjustment was
+	// split between the other devices. Only written if there were any.
+	if len(bs.Limits) > 0 {
+		records = append(records, []string{"**Caps and floors**", "Kind", "$Limit", "$Before", "$Adjustment"})
+
+		for _, l := range bs.Limits {
+			target := l.Target
+			if l.IsOwner {
+				target = "owner " + target
+			}
+
+			records = append(records, []string{
+				target,
+				l.Kind,
+				l.Limit.StringFixed(2),
+				l.Before.StringFixed(2),
+				l.Adjustment.StringFixed(2),
+			})
+		}
+	}
+
+	// Table 4 and 5: Itemized charges, then credits - 7 columns, up to <charge qty>*<deviceID qty> rows
+	// heading: Charge (or Credit), Category, Split, Amount, number, Nickname, Share
+	// entry for each number, for each charge. Charges attached to a device or owner only have
+	// entries for those devices. Only written if the bill has charges, or credits respectively.
+	chargeRecords := func(kind string, charges []tingbill.ChargeSplit) {
+		if len(charges) == 0 {
+			return
+		}
+
+		records = append(records, []string{"**" + kind + "**", "Category", "Split", "$Amount", "Phone Number", "Owner", "$Share"})
+
+		for _, c := range charges {
+			for _, id := range ids {
+				// Charges attached to a device or owner only get rows for those devices
+				if !c.Includes(id) {
+					continue
+				}
+
+				records = append(records, []string{
+					c.Name,
+					c.Category,
+					c.Strategy,
+					c.Amount.StringFixed(2),
+					id,
+					b.OwnerByID(id),
+					c.Costs[id].StringFixed(2),
+				})
+			}
+		}
+	}
+	chargeRecords("Charge", bs.Charges)
+	chargeRecords("Credit", bs.Credits)
+
+	// Table 6: Costs split - 12 columns, <deviceID qty>+1 rows
+	// heading: number, Nickname, Min, Msg, Data, Shared, Surcharges, Charges, Device, Credits, Limits, Total
 	// entry for each number
-	records = append(records, []string{"**Phone Number**", "Owner", "$Min", "$Msg", "$Data", "$Shared", "$Total"})
+	records = append(records, []string{"**Phone Number**", "Owner", "$Min", "$Msg", "$Data", "$Shared", "$Surcharges", "$Charges", "$Device", "$Credits", "$Limits", "$Total"})
 
 	for _, id := range ids {
-		userTotal := decimal.Sum(bs.MinuteCosts[id], bs.MessageCosts[id], bs.MegabyteCosts[id], bs.SharedCosts[id])
-
 		records = append(records, []string{
 			id,
 			b.OwnerByID(id),
@@ -161,10 +306,63 @@ func GenerateCSV(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			bs.MessageCosts[id].StringFixed(2),
 			bs.MegabyteCosts[id].StringFixed(2),
 			bs.SharedCosts[id].StringFixed(2),
-			userTotal.StringFixed(2),
+			bs.SurchargeCosts[id].StringFixed(2),
+			bs.ChargeTotal(id).StringFixed(2),
+			bs.DeviceChargeTotal(id).StringFixed(2),
+			bs.CreditTotal(id).StringFixed(2),
+			bs.LimitCosts[id].StringFixed(2),
+			bs.DeviceTotal(id).StringFixed(2),
 		})
 	}
 
+	// Table 7: Amount due per owner - 12 columns, <owner qty>+1 rows
+	// heading: Owner, Lines, Min, Msg, Data, Shared, Surcharges, Charges, Device, Credits, Limits, Total
+	// entry for each owner, in the order they appear on bill.toml
+	records = append(records, []string{"**Amount due per owner**", "Lines", "$Min", "$Msg", "$Data", "$Shared", "$Surcharges", "$Charges", "$Device", "$Credits", "$Limits", "$Total"})
+
+	for _, owner := range b.Owners() {
+		o := bs.OwnerCosts[owner]
+
+		records = append(records, []string{
+			owner,
+			strconv.Itoa(len(o.DeviceIDs)),
+			o.MinuteCosts.StringFixed(2),
+			o.MessageCosts.StringFixed(2),
+			o.MegabyteCosts.StringFixed(2),
+			o.SharedCosts.StringFixed(2),
+			o.SurchargeCosts.StringFixed(2),
+			o.ChargeCosts.StringFixed(2),
+			o.DeviceCharges.StringFixed(2),
+			o.CreditCosts.StringFixed(2),
+			o.LimitCosts.StringFixed(2),
+			o.Total.StringFixed(2),
+		})
+	}
+
+	// Table 8: Amount due per payer - 5 columns, <payer qty>*(<deviceID qty>+1) rows
+	// heading: Payer, number, Nickname, Share%, Amount
+	// entry for each number a payer pays for, then a "Total" entry for that payer
+	records = append(records, []string{"**Amount due per payer**", "Phone Number", "Owner", "Share%", "$Amount"})
+
+	for _, payer := range b.Payers() {
+		for _, d := range b.Devices {
+			amount, ok := bs.PayerCosts[payer][d.DeviceID]
+			if !ok {
+				continue
+			}
+
+			records = append(records, []string{
+				payer,
+				d.DeviceID,
+				d.Owner,
+				d.PayerShares()[payer].StringFixed(RoundPrecision),
+				amount.StringFixed(2),
+			})
+		}
+
+		records = append(records, []string{payer, "Total", "", "", bs.PayerTotal(payer).StringFixed(2)})
+	}
+
 	// Records complete, write to CSV
 	err = writer.WriteAll(records)
 
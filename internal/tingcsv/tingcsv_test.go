@@ -0,0 +1,133 @@
+package tingcsv
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hitjim/ting-bill-split/internal/tingparse"
+	"github.com/shopspring/decimal"
+)
+
+func TestGenerateCSVSurcharges(t *testing.T) {
+	u := tingparse.Usage{
+		Minutes: []tingparse.MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 10, Surcharge: decimal.NewFromFloat(1)},
+			{DeviceID: "1112224444", Minutes: 10},
+		},
+		Megabytes: []tingparse.MegabyteRecord{
+			{DeviceID: "1112223333", Kilobytes: 100, Surcharge: decimal.NewFromFloat(0.5)},
+		},
+	}
+
+	in := `description = "Surcharges test"
+total = 40.00
+minutes = 5.00
+devicesCost = 25.00
+fees = 10.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := tingparse.ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	bs, err := tingparse.CalculateSplit(u, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit() err, %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if _, err := GenerateCSV(bs, bil, path); err != nil {
+		t.Fatalf("GenerateCSV() err, %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("reading %s err, %v", path, err)
+	}
+
+	// The heading table is the header row, then the values: $Total, then $Calc
+	if got, want := records[1][3], records[1][2]; got != want {
+		t.Errorf("GenerateCSV() $Calc == %s, want $Total %s", got, want)
+	}
+}
+
+func TestGenerateCSVUsageWithoutDirection(t *testing.T) {
+	u := tingparse.Usage{
+		Minutes: []tingparse.MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 10},
+			{DeviceID: "1112224444", Minutes: 5, Direction: tingparse.DirectionOutgoing},
+		},
+	}
+
+	in := `description = "Direction test"
+total = 5.00
+minutes = 5.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := tingparse.ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	bs, err := tingparse.CalculateSplit(u, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit() err, %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if _, err := GenerateCSV(bs, bil, path); err != nil {
+		t.Fatalf("GenerateCSV() err, %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("reading %s err, %v", path, err)
+	}
+
+	// The usage table follows the heading table's 2 rows, then has its own header row
+	want := [][]string{
+		{"1112223333", "owner1", "10", "0", "0"},
+		{"1112224444", "owner2", "5", "5", "0"},
+	}
+	for i, w := range want {
+		if got := records[3+i][:5]; strings.Join(got, ",") != strings.Join(w, ",") {
+			t.Errorf("GenerateCSV() usage row %d == %v, want %v", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tingparse
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// Remainder policies control who receives the leftover cents after every share of a cost
+// has been rounded down to the cent. Set with `remainderPolicy` in bill.toml.
+const (
+	// RemainderLargest hands out leftover cents one at a time, to the devices whose shares
+	// lost the most when rounded down. This is the default.
+	RemainderLargest = "largest"
+	// RemainderShortStraw gives every leftover cent to the Bill's ShortStrawID.
+	RemainderShortStraw = "shortStraw"
+)
+
+// CentPrecision is the number of decimal places every split amount is rounded to.
+const CentPrecision = int32(2)
+
+var cent = decimal.New(1, -CentPrecision)
+
+// validRemainderPolicy returns true if p is empty (use the default) or a known remainder policy.
+func validRemainderPolicy(p string) bool {
+	return p == "" || p == RemainderLargest || p == RemainderShortStraw
+}
+
+// allocation is a cent-exact split of Amount, along with the numbers that produced it, so the
+// split can be explained later. Exact shares are before rounding, Rounded shares are rounded
+// toward zero, and Shares include any leftover cents handed out by the remainder policy.
+// IDs are the devices which took part, in the order they were given.
+type allocation struct {
+	IDs         []string
+	Amount      decimal.Decimal
+	Weights     map[string]decimal.Decimal
+	TotalWeight decimal.Decimal
+	Exact       map[string]decimal.Decimal
+	Rounded     map[string]decimal.Decimal
+	Shares      map[string]decimal.Decimal
+}
+
+// allocateCents splits amount across ids in proportion to weights, and returns a map of
+// cent-exact shares which always sum to amount. Each share is first rounded toward zero to
+// the cent, then the leftover cents are handed out according to policy.
+// Ties are broken in favor of shortStrawID, then by the order of ids.
+func allocateCents(amount decimal.Decimal, ids []string, weights map[string]decimal.Decimal, policy string, shortStrawID string) (map[string]decimal.Decimal, error) {
+	a, err := allocate(amount, ids, weights, policy, shortStrawID)
+	return a.Shares, err
+}
+
+// allocate works like allocateCents, but returns the whole allocation.
+func allocate(amount decimal.Decimal, ids []string, weights map[string]decimal.Decimal, policy string, shortStrawID string) (allocation, error) {
+	shares := make(map[string]decimal.Decimal)
+	amount = amount.Round(CentPrecision)
+	a := allocation{
+		IDs:     ids,
+		Amount:  amount,
+		Weights: weights,
+		Exact:   make(map[string]decimal.Decimal),
+		Rounded: make(map[string]decimal.Decimal),
+		Shares:  shares,
+	}
+
+	totalWeight := decimal.Zero
+	for _, id := range ids {
+		if weights[id].IsNegative() {
+			return a, fmt.Errorf("negative weight %s for deviceId %s", weights[id], id)
+		}
+		totalWeight = totalWeight.Add(weights[id])
+	}
+	a.TotalWeight = totalWeight
+
+	if totalWeight.IsZero() {
+		if amount.IsZero() {
+			for _, id := range ids {
+				shares[id] = decimal.Zero
+				a.Exact[id] = decimal.Zero
+				a.Rounded[id] = decimal.Zero
+			}
+			return a, nil
+		}
+		return a, fmt.Errorf("unable to split $%s, no device has any weight", amount.StringFixed(CentPrecision))
+	}
+
+	// Round every share toward zero, and remember how much each one lost
+	lost := make(map[string]decimal.Decimal)
+	sum := decimal.Zero
+	for _, id := range ids {
+		exact := amount.Mul(weights[id]).DivRound(totalWeight, 16)
+		shares[id] = exact.Truncate(CentPrecision)
+		a.Exact[id] = exact
+		a.Rounded[id] = shares[id]
+		lost[id] = exact.Sub(shares[id]).Abs()
+		sum = sum.Add(shares[id])
+	}
+
+	leftover := amount.Sub(sum)
+	step := cent
+	if leftover.IsNegative() {
+		step = cent.Neg()
+	}
+	cents := int(leftover.Div(step).IntPart())
+
+	if cents > 0 {
+		if policy == RemainderShortStraw {
+			if _, ok := shares[shortStrawID]; !ok {
+				return a, fmt.Errorf("shortStrawId %s is not one of the bill's devices", shortStrawID)
+			}
+			shares[shortStrawID] = shares[shortStrawID].Add(step.Mul(decimal.New(int64(cents), 0)))
+		} else {
+			order := make([]string, len(ids))
+			copy(order, ids)
+			sort.SliceStable(order, func(i, j int) bool {
+				if cmp := lost[order[i]].Cmp(lost[order[j]]); cmp != 0 {
+					return cmp > 0
+				}
+				return order[i] == shortStrawID && order[j] != shortStrawID
+			})
+
+			for i := 0; i < cents; i++ {
+				id := order[i%len(order)]
+				shares[id] = shares[id].Add(step)
+			}
+		}
+	}
+
+	check := decimal.Zero
+	for _, id := range ids {
+		check = check.Add(shares[id])
+	}
+
+	if !check.Equal(amount) {
+		return a, fmt.Errorf("split of $%s only accounts for $%s", amount.StringFixed(CentPrecision), check.StringFixed(CentPrecision))
+	}
+
+	return a, nil
+}
@@ -0,0 +1,146 @@
+package tingparse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// Directions of a call or message, as MinuteRecord.Direction and MessageRecord.Direction.
+// Sent messages are outgoing, and received messages are incoming.
+const (
+	DirectionOutgoing = "outgoing"
+	DirectionIncoming = "incoming"
+)
+
+// Counting policies decide which directions of minutes or messages count as a device's usage.
+// Set with `policy` in the `[counting.minutes]` and `[counting.messages]` tables of bill.toml.
+// Rows without a direction always count fully.
+const (
+	// CountAll counts both directions. This is the default.
+	CountAll = "all"
+	// CountOutgoing only counts calls made and messages sent.
+	CountOutgoing = "outgoing"
+	// CountIncoming only counts calls and messages received.
+	CountIncoming = "incoming"
+	// CountWeighted counts each direction by its weight, set with `outgoing` and `incoming`.
+	CountWeighted = "weighted"
+)
+
+// parseDirection returns the direction of a call or message from its csv value, like "outgoing"
+// or "sent", or an empty string if it isn't known.
+func parseDirection(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "outgoing", "sent":
+		return DirectionOutgoing
+	case "incoming", "received":
+		return DirectionIncoming
+	}
+
+	return ""
+}
+
+// checkCounting makes sure every `[counting.*]` table in bill.toml names a known counting policy,
+// and that "weighted" has usable weights.
+func checkCounting(b tingbill.Bill) error {
+	policies := []struct {
+		name string
+		p    tingbill.CountingPolicy
+	}{
+		{CategoryMinutes, b.Counting.Minutes},
+		{CategoryMessages, b.Counting.Messages},
+	}
+
+	for _, c := range policies {
+		switch c.p.Policy {
+		case "", CountAll, CountOutgoing, CountIncoming:
+		case CountWeighted:
+			if c.p.Outgoing.IsNegative() || c.p.Incoming.IsNegative() {
+				return fmt.Errorf("counting.%s weights can't be negative", c.name)
+			}
+			if c.p.Outgoing.IsZero() && c.p.Incoming.IsZero() {
+				return fmt.Errorf("counting.%s is %q, but doesn't set an outgoing or incoming weight", c.name, CountWeighted)
+			}
+		default:
+			return fmt.Errorf("counting.%s has unknown policy %q, expected %q, %q, %q or %q",
+				c.name, c.p.Policy, CountAll, CountOutgoing, CountIncoming, CountWeighted)
+		}
+	}
+
+	return nil
+}
+
+// directionWeights returns how much outgoing and incoming usage count for under p.
+func directionWeights(p tingbill.CountingPolicy) (decimal.Decimal, decimal.Decimal) {
+	one := decimal.New(1, 0)
+
+	switch p.Policy {
+	case CountOutgoing:
+		return one, decimal.Zero
+	case CountIncoming:
+		return decimal.Zero, one
+	case CountWeighted:
+		return p.Outgoing, p.Incoming
+	}
+
+	return one, one
+}
+
+// directedUsage is a single row of usage with a direction, like a call or a message.
+type directedUsage struct {
+	deviceID  string
+	direction string
+	qty       int
+}
+
+// countUsage totals rows for each device. It returns the usage counted by the counting policy p,
+// which is fractional if p has fractional weights, and the outgoing and incoming usage. Each map
+// is keyed by deviceId.
+func countUsage(rows []directedUsage, p tingbill.CountingPolicy) (map[string]decimal.Decimal, map[string]int, map[string]int) {
+	outWeight, inWeight := directionWeights(p)
+
+	counted := make(map[string]decimal.Decimal)
+	out := make(map[string]int)
+	in := make(map[string]int)
+
+	for _, r := range rows {
+		weight := decimal.New(1, 0)
+
+		switch r.direction {
+		case DirectionOutgoing:
+			out[r.deviceID] += r.qty
+			weight = outWeight
+		case DirectionIncoming:
+			in[r.deviceID] += r.qty
+			weight = inWeight
+		}
+
+		counted[r.deviceID] = counted[r.deviceID].Add(decimal.New(int64(r.qty), 0).Mul(weight))
+	}
+
+	return counted, out, in
+}
+
+// minuteUsage totals the minutes used in records for each device, by the counting policy p.
+// It also returns the outgoing and incoming minutes. Each map is keyed by deviceId.
+func minuteUsage(records []MinuteRecord, p tingbill.CountingPolicy) (map[string]decimal.Decimal, map[string]int, map[string]int) {
+	rows := make([]directedUsage, len(records))
+	for i, r := range records {
+		rows[i] = directedUsage{r.DeviceID, r.Direction, r.Minutes}
+	}
+
+	return countUsage(rows, p)
+}
+
+// messageUsage counts the messages in records for each device, by the counting policy p.
+// It also returns the messages sent and received. Each map is keyed by deviceId.
+func messageUsage(records []MessageRecord, p tingbill.CountingPolicy) (map[string]decimal.Decimal, map[string]int, map[string]int) {
+	rows := make([]directedUsage, len(records))
+	for i, r := range records {
+		rows[i] = directedUsage{r.DeviceID, r.Direction, 1}
+	}
+
+	return countUsage(rows, p)
+}
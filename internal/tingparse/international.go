@@ -0,0 +1,193 @@
+package tingparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// defaultHomeCountries are the names the usage csv files use for the United States.
+var defaultHomeCountries = []string{"USA", "US", "United States", "United States of America"}
+
+// internationalAmountKeys are the keys in the `[international]` table of bill.toml holding
+// US Dollar amounts or rates.
+var internationalAmountKeys = []string{"minuteRate", "messageRate", "minutes", "messages"}
+
+// checkInternational makes sure the `[international]` table in bill.toml doesn't have negative
+// rates or amounts, and that each category has a rate or an amount, but not both.
+func checkInternational(b tingbill.Bill) error {
+	p := b.International
+
+	categories := []struct {
+		name   string
+		rate   decimal.Decimal
+		amount decimal.Decimal
+	}{
+		{CategoryMinutes, p.MinuteRate, p.Minutes},
+		{CategoryMessages, p.MessageRate, p.Messages},
+	}
+
+	for _, c := range categories {
+		if c.rate.IsNegative() || c.amount.IsNegative() {
+			return fmt.Errorf("international %s rate and amount can't be negative", c.name)
+		}
+
+		if !c.rate.IsZero() && !c.amount.IsZero() {
+			return fmt.Errorf("international %s can have a rate or an amount from the bill, but not both", c.name)
+		}
+	}
+
+	return nil
+}
+
+// homeCountries returns a function which is true if country is one of the Bill's home
+// countries, ignoring case. An empty country is always home.
+func homeCountries(bil tingbill.Bill) func(country string) bool {
+	countries := bil.International.HomeCountries
+	if len(countries) == 0 {
+		countries = defaultHomeCountries
+	}
+
+	home := make(map[string]bool)
+	for _, c := range countries {
+		home[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+
+	return func(country string) bool {
+		c := strings.ToLower(strings.TrimSpace(country))
+		return c == "" || home[c]
+	}
+}
+
+// internationalUsage totals the roaming and international minutes and messages in u for each
+// device. A call is international if the device or the other side of the call was outside the
+// home countries, and a message is if the device was roaming. It also returns the countries
+// each device roamed in or contacted, sorted. Each map is keyed by deviceId.
+func internationalUsage(u Usage, bil tingbill.Bill) (map[string]int, map[string]int, map[string][]string) {
+	isHome := homeCountries(bil)
+	min := make(map[string]int)
+	msg := make(map[string]int)
+	seen := make(map[string]map[string]bool)
+
+	addCountry := func(id string, country string) {
+		if isHome(country) {
+			return
+		}
+		if seen[id] == nil {
+			seen[id] = make(map[string]bool)
+		}
+		seen[id][country] = true
+	}
+
+	for _, r := range u.Minutes {
+		if isHome(r.Country) && isHome(r.PartnerCountry) {
+			continue
+		}
+
+		min[r.DeviceID] += r.Minutes
+		addCountry(r.DeviceID, r.Country)
+		addCountry(r.DeviceID, r.PartnerCountry)
+	}
+
+	for _, r := range u.Messages {
+		if !r.Roaming {
+			continue
+		}
+
+		msg[r.DeviceID]++
+		addCountry(r.DeviceID, r.RoamingCountry)
+	}
+
+	countries := make(map[string][]string)
+	for id, names := range seen {
+		for c := range names {
+			countries[id] = append(countries[id], c)
+		}
+		sort.Strings(countries[id])
+	}
+
+	return min, msg, countries
+}
+
+// unratedUsage returns u without the roaming and international minutes and messages which are
+// charged at a rate by the Bill's `[international]` table. Those have already paid for their
+// share, so the rest of the minutes or messages cost is split by the other usage.
+func unratedUsage(u Usage, bil tingbill.Bill) Usage {
+	isHome := homeCountries(bil)
+	unrated := Usage{Megabytes: u.Megabytes}
+
+	for _, r := range u.Minutes {
+		if bil.International.MinuteRate.IsZero() || (isHome(r.Country) && isHome(r.PartnerCountry)) {
+			unrated.Minutes = append(unrated.Minutes, r)
+		}
+	}
+
+	for _, r := range u.Messages {
+		if bil.International.MessageRate.IsZero() || !r.Roaming {
+			unrated.Messages = append(unrated.Messages, r)
+		}
+	}
+
+	return unrated
+}
+
+// splitInternational charges the roaming and international usage of a category to the devices
+// that used it, by their share of that usage. With a rate, the cost is usage x rate, which is
+// taken out of pool, the usage cost it's included in on the Ting bill. Otherwise amount is the
+// category's own line on the Ting bill. It returns what each of the Bill's devices pays, and
+// what's left of pool.
+func splitInternational(item string, rate decimal.Decimal, amount decimal.Decimal, usage map[string]int, pool decimal.Decimal, bs *tingbill.BillSplit, bil tingbill.Bill) (map[string]decimal.Decimal, decimal.Decimal, error) {
+	shares := make(map[string]decimal.Decimal)
+
+	var used []string
+	var total int
+	weights := make(map[string]decimal.Decimal)
+
+	for _, id := range bil.DeviceIds() {
+		shares[id] = decimal.Zero
+
+		if usage[id] > 0 {
+			used = append(used, id)
+			weights[id] = decimal.New(int64(usage[id]), 0)
+			total += usage[id]
+		}
+	}
+
+	if !rate.IsZero() {
+		amount = rate.Mul(decimal.New(int64(total), 0)).Round(CentPrecision)
+		if amount.GreaterThan(pool) {
+			return shares, pool, fmt.Errorf("%d %s at $%s each is $%s, more than the $%s it's included in", total, strings.ToLower(item), rate, amount.StringFixed(CentPrecision), pool.StringFixed(CentPrecision))
+		}
+		pool = pool.Sub(amount)
+		item = fmt.Sprintf("%s at $%s each", item, rate)
+	}
+
+	if amount.IsZero() {
+		return shares, pool, nil
+	}
+
+	if len(used) == 0 {
+		return shares, pool, fmt.Errorf("%s cost $%s, but there's no usage to split it by", strings.ToLower(item), amount.StringFixed(CentPrecision))
+	}
+
+	shortStrawID := bil.ShortStrawID
+	if weights[shortStrawID].IsZero() {
+		shortStrawID = used[0]
+	}
+
+	a, err := allocate(amount, used, weights, bil.RemainderPolicy, shortStrawID)
+	if err != nil {
+		return shares, pool, err
+	}
+
+	for _, id := range used {
+		shares[id] = a.Shares[id]
+	}
+
+	recordSplit(bs, item, StrategyProportional, decimalUsage(usage), a)
+
+	return shares, pool, nil
+}
@@ -0,0 +1,405 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// Kinds of limits, used as tingbill.LimitSplit.Kind.
+const (
+	LimitCap   = "cap"
+	LimitFloor = "floor"
+)
+
+// WarnLimit means a cap or floor was applied, and the difference was split between the
+// devices without a limit.
+const WarnLimit = "limit-applied"
+
+// limitUnit is a device or owner with a cap or floor. ids are every device it pays for.
+type limitUnit struct {
+	target  string
+	isOwner bool
+	ids     []string
+	cap     *decimal.Decimal
+	floor   *decimal.Decimal
+}
+
+// checkLimits makes sure caps and floors in bill.toml make sense. A device can't have its own
+// limits if its owner has limits too.
+func checkLimits(b tingbill.Bill) error {
+	check := func(target string, l tingbill.Limits) error {
+		if l.Cap != nil && l.Cap.IsNegative() {
+			return fmt.Errorf("%s cap can't be negative, got %s", target, l.Cap)
+		}
+
+		if l.Floor != nil && l.Floor.IsNegative() {
+			return fmt.Errorf("%s floor can't be negative, got %s", target, l.Floor)
+		}
+
+		if l.Cap != nil && l.Floor != nil && l.Floor.GreaterThan(*l.Cap) {
+			return fmt.Errorf("%s floor %s is more than its cap %s", target, l.Floor, l.Cap)
+		}
+
+		return nil
+	}
+
+	owners := make(map[string]bool)
+	for _, owner := range b.Owners() {
+		owners[owner] = true
+	}
+
+	for owner, l := range b.OwnerLimits {
+		if !owners[owner] {
+			return fmt.Errorf("owners.%s has limits, but no device has that owner", owner)
+		}
+
+		if err := check("owner "+owner, l); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range b.Devices {
+		if !d.Limits.IsSet() {
+			continue
+		}
+
+		if b.OwnerLimits[d.Owner].IsSet() {
+			return fmt.Errorf("deviceId %s has a cap or floor, and so does its owner %s, only set one of them", d.DeviceID, d.Owner)
+		}
+
+		if err := check("deviceId "+d.DeviceID, d.Limits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkLimitAmounts makes sure any cap or floor in a raw bill.toml table is a valid amount.
+func checkLimitAmounts(table map[string]interface{}) error {
+	for _, key := range []string{LimitCap, LimitFloor} {
+		if v, exists := table[key]; exists {
+			if _, err := decodeAmount(v); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// limitUnits returns every device and owner with a cap or floor, owners first, then devices,
+// both in the order they appear on the Bill. devShares is each device's share of DevicesCost,
+// used as a floor when the Bill has FloorDevicesShare set. It's an error for that share to be
+// more than the cap, since both limits can't be met.
+func limitUnits(bil tingbill.Bill, devShares map[string]decimal.Decimal) ([]limitUnit, error) {
+	var units []limitUnit
+	inOwnerUnit := make(map[string]bool)
+
+	for _, owner := range bil.Owners() {
+		l, ok := bil.OwnerLimits[owner]
+		if !ok || !l.IsSet() {
+			continue
+		}
+
+		u := limitUnit{target: owner, isOwner: true, ids: bil.DeviceIdsByOwner(owner), cap: l.Cap, floor: l.Floor}
+
+		if bil.FloorDevicesShare {
+			floor := decimal.Zero
+			for _, id := range u.ids {
+				floor = floor.Add(devShares[id])
+			}
+			u.floor = maxLimit(u.floor, floor)
+			if err := checkDevicesShareFloor(u); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range u.ids {
+			inOwnerUnit[id] = true
+		}
+
+		units = append(units, u)
+	}
+
+	for _, d := range bil.Devices {
+		if inOwnerUnit[d.DeviceID] || (!d.Limits.IsSet() && !bil.FloorDevicesShare) {
+			continue
+		}
+
+		u := limitUnit{target: d.DeviceID, ids: []string{d.DeviceID}, cap: d.Cap, floor: d.Floor}
+
+		if bil.FloorDevicesShare {
+			u.floor = maxLimit(u.floor, devShares[d.DeviceID])
+			if err := checkDevicesShareFloor(u); err != nil {
+				return nil, err
+			}
+		}
+
+		units = append(units, u)
+	}
+
+	return units, nil
+}
+
+// checkDevicesShareFloor makes sure the floor floorDevicesShare sets for u isn't more than its cap.
+func checkDevicesShareFloor(u limitUnit) error {
+	if u.cap != nil && u.floor.GreaterThan(*u.cap) {
+		target := "deviceId " + u.target
+		if u.isOwner {
+			target = "owner " + u.target
+		}
+
+		return fmt.Errorf("%s cap $%s is less than its share of devicesCost $%s, which floorDevicesShare sets as its floor", target, u.cap.StringFixed(CentPrecision), u.floor.StringFixed(CentPrecision))
+	}
+
+	return nil
+}
+
+// maxLimit returns the larger of an optional limit and an amount.
+func maxLimit(limit *decimal.Decimal, amount decimal.Decimal) *decimal.Decimal {
+	if limit != nil && limit.GreaterThan(amount) {
+		return limit
+	}
+
+	return &amount
+}
+
+// applyLimits enforces every cap and floor on the Bill. When a device or owner goes over its
+// cap, or under its floor, it's set to exactly its limit, and the difference is split between
+// the devices which haven't had a limit applied, using the same policies that split the costs
+// making up what it owed. That can push another device over its own cap or under its floor,
+// so this repeats until every limit is met. Each device or owner is only limited once, so it
+// always converges. devSplit is how DevicesCost was split.
+func applyLimits(bs *tingbill.BillSplit, bil tingbill.Bill, devSplit allocation) error {
+	units, err := limitUnits(bil, devSplit.Shares)
+	if err != nil {
+		return err
+	}
+
+	if len(units) == 0 {
+		return nil
+	}
+
+	ids := bil.DeviceIds()
+	limited := make(map[string]bool)
+
+	bs.LimitCosts = make(map[string]decimal.Decimal)
+	for _, id := range ids {
+		bs.LimitCosts[id] = decimal.Zero
+	}
+
+	for {
+		u, kind, limit, before, ok := nextLimit(*bs, units, limited)
+		if !ok {
+			return nil
+		}
+
+		for _, id := range u.ids {
+			limited[id] = true
+		}
+
+		var free []string
+		for _, id := range ids {
+			if !limited[id] {
+				free = append(free, id)
+			}
+		}
+
+		if len(free) == 0 {
+			return fmt.Errorf("can't apply the %s of $%s for %s, every other device already has a limit applied", kind, limit.StringFixed(CentPrecision), u.target)
+		}
+
+		adjustment := limit.Sub(before)
+
+		// Redistribution weights are based on the costs before the unit is adjusted
+		weights := redistributionWeights(*bs, u.ids, free, devSplit.Weights)
+
+		own, err := allocate(adjustment, u.ids, ownWeights(*bs, u.ids), RemainderLargest, u.ids[0])
+		if err != nil {
+			return fmt.Errorf("applying the %s for %s: %w", kind, u.target, err)
+		}
+
+		shortStrawID := bil.ShortStrawID
+		if limited[shortStrawID] {
+			shortStrawID = free[0]
+		}
+
+		spread, err := allocate(adjustment.Neg(), free, weights, bil.RemainderPolicy, shortStrawID)
+		if err != nil {
+			return fmt.Errorf("redistributing the %s for %s: %w", kind, u.target, err)
+		}
+
+		for _, id := range u.ids {
+			bs.LimitCosts[id] = bs.LimitCosts[id].Add(own.Shares[id])
+		}
+
+		for _, id := range free {
+			bs.LimitCosts[id] = bs.LimitCosts[id].Add(spread.Shares[id])
+		}
+
+		label := fmt.Sprintf("%s of $%s for %s", kind, limit.StringFixed(CentPrecision), u.target)
+		recordSplit(bs, label, kind, nil, own)
+		recordSplit(bs, "Redistributed "+label, kind, nil, spread)
+
+		bs.Limits = append(bs.Limits, tingbill.LimitSplit{
+			Target:     u.target,
+			IsOwner:    u.isOwner,
+			Kind:       kind,
+			Limit:      limit,
+			Before:     before,
+			Adjustment: adjustment,
+		})
+
+		// A cap moves cost to the other lines, and a floor moves it from them
+		direction := "to"
+		if kind == LimitFloor {
+			direction = "from"
+		}
+
+		bs.Warnings = append(bs.Warnings, tingbill.Warning{
+			Code:     WarnLimit,
+			Severity: tingbill.SeverityInfo,
+			Message:  fmt.Sprintf("%s would have paid %s, the %s of $%s moved $%s %s the other lines", u.target, dollars(before), kind, limit.StringFixed(CentPrecision), adjustment.Abs().StringFixed(CentPrecision), direction),
+			Context:  map[string]string{"target": u.target, "kind": kind, "limit": limit.StringFixed(CentPrecision)},
+		})
+	}
+}
+
+// dollars formats d as a US Dollar amount, with the sign in front, like "-$10.00".
+func dollars(d decimal.Decimal) string {
+	if d.IsNegative() {
+		return "-$" + d.Neg().StringFixed(CentPrecision)
+	}
+
+	return "$" + d.StringFixed(CentPrecision)
+}
+
+// nextLimit returns the first unit which isn't limited yet, and is over its cap or under its floor,
+// along with the kind of limit, the limit, and what the unit currently pays.
+func nextLimit(bs tingbill.BillSplit, units []limitUnit, limited map[string]bool) (limitUnit, string, decimal.Decimal, decimal.Decimal, bool) {
+	for _, u := range units {
+		if limited[u.ids[0]] {
+			continue
+		}
+
+		total := decimal.Zero
+		for _, id := range u.ids {
+			total = total.Add(bs.DeviceTotal(id))
+		}
+
+		if u.cap != nil && total.GreaterThan(*u.cap) {
+			return u, LimitCap, *u.cap, total, true
+		}
+
+		if u.floor != nil && total.LessThan(*u.floor) {
+			return u, LimitFloor, *u.floor, total, true
+		}
+	}
+
+	return limitUnit{}, "", decimal.Zero, decimal.Zero, false
+}
+
+// ownWeights returns the weights used to split an adjustment between a unit's own devices,
+// which is by what each of them pays, or evenly if any of them pay nothing or less.
+func ownWeights(bs tingbill.BillSplit, ids []string) map[string]decimal.Decimal {
+	w := make(map[string]decimal.Decimal)
+
+	for _, id := range ids {
+		total := bs.DeviceTotal(id)
+		if !total.IsPositive() {
+			return evenWeights(ids)
+		}
+		w[id] = total
+	}
+
+	return w
+}
+
+// redistributionWeights returns the weights used to split a unit's adjustment between the free
+// devices. Each cost the unit paid for, like minutes or a charge, contributes to the weights by
+// its part of what the unit paid, using the weights that cost was originally split by. If the
+// unit didn't pay for anything, the devicesCost weights in devWeights are used instead.
+func redistributionWeights(bs tingbill.BillSplit, unitIDs []string, free []string, devWeights map[string]decimal.Decimal) map[string]decimal.Decimal {
+	var items []string
+	paid := make(map[string]decimal.Decimal)
+	weights := make(map[string]map[string]decimal.Decimal)
+
+	for _, id := range append(append([]string{}, unitIDs...), free...) {
+		for _, s := range bs.Audit[id] {
+			if s.Strategy == LimitCap || s.Strategy == LimitFloor {
+				continue
+			}
+
+			if _, ok := weights[s.Item]; !ok {
+				items = append(items, s.Item)
+				weights[s.Item] = make(map[string]decimal.Decimal)
+			}
+			weights[s.Item][id] = s.Weight
+		}
+	}
+
+	total := decimal.Zero
+	for _, id := range unitIDs {
+		for _, s := range bs.Audit[id] {
+			if s.Strategy == LimitCap || s.Strategy == LimitFloor || !s.Share.IsPositive() {
+				continue
+			}
+			paid[s.Item] = paid[s.Item].Add(s.Share)
+			total = total.Add(s.Share)
+		}
+	}
+
+	if total.IsZero() {
+		w := make(map[string]decimal.Decimal)
+		sum := decimal.Zero
+		for _, id := range free {
+			w[id] = devWeights[id]
+			sum = sum.Add(devWeights[id])
+		}
+
+		if !sum.IsPositive() {
+			return evenWeights(free)
+		}
+
+		return w
+	}
+
+	w := make(map[string]decimal.Decimal)
+	for _, id := range free {
+		w[id] = decimal.Zero
+	}
+
+	for _, item := range items {
+		if !paid[item].IsPositive() {
+			continue
+		}
+		part := paid[item].DivRound(total, 16)
+
+		itemWeights := weights[item]
+		sum := decimal.Zero
+		for _, id := range free {
+			sum = sum.Add(itemWeights[id])
+		}
+
+		// Nobody free took part in this cost, so its part is split evenly
+		if !sum.IsPositive() {
+			itemWeights = evenWeights(free)
+			sum = decimal.New(int64(len(free)), 0)
+		}
+
+		for _, id := range free {
+			w[id] = w[id].Add(part.Mul(itemWeights[id]).DivRound(sum, 16))
+		}
+	}
+
+	return w
+}
+
+// evenWeights gives every id a weight of 1.
+func evenWeights(ids []string) map[string]decimal.Decimal {
+	w, _ := EvenStrategy{}.Weights(ids, nil)
+	return w
+}
@@ -0,0 +1,47 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// checkNetworkWeights makes sure no network type in bill.toml has a negative weight.
+func checkNetworkWeights(b tingbill.Bill) error {
+	for _, t := range b.NetworkWeights.Keys() {
+		if w := b.NetworkWeights[t]; w.IsNegative() {
+			return fmt.Errorf("networkWeights %q can't be negative, got %s", t, w)
+		}
+	}
+
+	return nil
+}
+
+// networkUsage totals the data used in records for each device. It returns the kilobytes
+// used, those kilobytes broken down by network type, and the usage after the Bill's
+// NetworkWeights are applied, rounded to the nearest kilobyte. Each map is keyed by deviceId.
+func networkUsage(records []MegabyteRecord, bil tingbill.Bill) (map[string]int, map[string]map[string]int, map[string]int) {
+	kb := make(map[string]int)
+	byType := make(map[string]map[string]int)
+
+	for _, r := range records {
+		kb[r.DeviceID] += r.Kilobytes
+
+		if byType[r.DeviceID] == nil {
+			byType[r.DeviceID] = make(map[string]int)
+		}
+		byType[r.DeviceID][r.Type] += r.Kilobytes
+	}
+
+	weighted := make(map[string]int)
+	for id, types := range byType {
+		sum := decimal.Zero
+		for t, v := range types {
+			sum = sum.Add(decimal.New(int64(v), 0).Mul(bil.NetworkWeight(t)))
+		}
+		weighted[id] = int(sum.Round(0).IntPart())
+	}
+
+	return kb, byType, weighted
+}
@@ -0,0 +1,259 @@
+package tingparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+)
+
+// WarnOutsidePeriod means rows of a usage csv file were from outside the Bill's billing period,
+// like when an export overlaps the previous cycle. Those rows are left out of the split.
+const WarnOutsidePeriod = "csv-outside-period"
+
+// csvDateLayouts are the formats of the "Date" column in the usage csv files, like "February 03, 2011".
+var csvDateLayouts = []string{"January 02, 2006", tingbill.DateLayout, "01/02/2006"}
+
+// csvTimeLayouts are the formats of the "Time" column in the usage csv files, like "01:11".
+var csvTimeLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM"}
+
+// parseDateTime returns the date in column dateIndex of a csv record, at the time of day in
+// column timeIndex if there is one. A missing date column, or an empty value, is the zero time.
+// A bad date or time is a *ParseError.
+func parseDateTime(record []string, dateIndex int, timeIndex int) (time.Time, error) {
+	d := strings.TrimSpace(optionalField(record, dateIndex))
+	if d == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := parseLayouts(d, csvDateLayouts)
+	if err != nil {
+		return time.Time{}, &ParseError{Column: "Date", Value: d, Err: fmt.Errorf("%q isn't a valid date, expected one like \"February 03, 2011\"", d)}
+	}
+
+	t := strings.TrimSpace(optionalField(record, timeIndex))
+	if t == "" {
+		return date, nil
+	}
+
+	clock, err := parseLayouts(strings.ToUpper(t), csvTimeLayouts)
+	if err != nil {
+		return time.Time{}, &ParseError{Column: "Time", Value: t, Err: fmt.Errorf("%q isn't a valid time, expected one like \"01:11\"", t)}
+	}
+
+	return date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute + time.Duration(clock.Second())*time.Second), nil
+}
+
+// parseLayouts parses v with the first of layouts that fits it.
+func parseLayouts(v string, layouts []string) (time.Time, error) {
+	var err error
+
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// periodUsage returns u without the rows from outside the Bill's billing period, and a
+// WarnOutsidePeriod warning for each usage csv file that had any, with how many were left out.
+// Rows without a date, and every row of a Bill without a billing period, are kept.
+func periodUsage(u Usage, bil tingbill.Bill) (Usage, []tingbill.Warning) {
+	if bil.PeriodStart.IsZero() {
+		return u, nil
+	}
+
+	start := bil.PeriodStart.Time
+	end := bil.PeriodEnd.AddDate(0, 0, 1)
+
+	inPeriod := func(t time.Time) bool {
+		return t.IsZero() || (!t.Before(start) && t.Before(end))
+	}
+
+	var kept Usage
+	excluded := make(map[string]int)
+
+	for _, r := range u.Minutes {
+		if inPeriod(r.Date) {
+			kept.Minutes = append(kept.Minutes, r)
+		} else {
+			excluded[CategoryMinutes]++
+		}
+	}
+
+	for _, r := range u.Messages {
+		if inPeriod(r.Date) {
+			kept.Messages = append(kept.Messages, r)
+		} else {
+			excluded[CategoryMessages]++
+		}
+	}
+
+	for _, r := range u.Megabytes {
+		if inPeriod(r.Date) {
+			kept.Megabytes = append(kept.Megabytes, r)
+		} else {
+			excluded[CategoryMegabytes]++
+		}
+	}
+
+	var warnings []tingbill.Warning
+	for _, category := range []string{CategoryMinutes, CategoryMessages, CategoryMegabytes} {
+		if excluded[category] == 0 {
+			continue
+		}
+
+		warnings = append(warnings, tingbill.Warning{
+			Code:     WarnOutsidePeriod,
+			Severity: tingbill.SeverityWarning,
+			Message:  fmt.Sprintf("left out %s csv file rows from outside the billing period %s to %s: %d", category, bil.PeriodStart, bil.PeriodEnd, excluded[category]),
+			Context:  map[string]string{"file": category, "rows": strconv.Itoa(excluded[category])},
+		})
+	}
+
+	return kept, warnings
+}
+
+// WarnDerivedPeriod means the Bill didn't have a billing period, so it was taken from the dates
+// in the usage csv files.
+const WarnDerivedPeriod = "period-from-usage"
+
+// WarnDateRanges means the usage csv files cover different dates, like when one of them was
+// exported for another billing period.
+const WarnDateRanges = "csv-date-ranges"
+
+// dateRangeSlack is how far apart the first or last dates of the usage csv files can be before
+// they're flagged. Lines don't use everything every day, so they rarely match exactly.
+const dateRangeSlack = 3 * 24 * time.Hour
+
+// DateRange is the first and last dates of some usage. Both are the zero time if none of the
+// usage has a date.
+type DateRange struct {
+	First time.Time
+	Last  time.Time
+}
+
+// IsZero returns true if none of the usage had a date.
+func (r DateRange) IsZero() bool {
+	return r.First.IsZero()
+}
+
+// String returns the range as days, like "2019-09-03..2019-10-02".
+func (r DateRange) String() string {
+	return r.First.Format(tingbill.DateLayout) + ".." + r.Last.Format(tingbill.DateLayout)
+}
+
+// add widens r to include t, unless t is the zero time.
+func (r DateRange) add(t time.Time) DateRange {
+	if t.IsZero() {
+		return r
+	}
+
+	if r.First.IsZero() || t.Before(r.First) {
+		r.First = t
+	}
+
+	if r.Last.IsZero() || t.After(r.Last) {
+		r.Last = t
+	}
+
+	return r
+}
+
+// DateRanges returns the DateRange of the rows from each usage csv file in u, keyed by category.
+func (u Usage) DateRanges() map[string]DateRange {
+	var min, msg, meg DateRange
+
+	for _, r := range u.Minutes {
+		min = min.add(r.Date)
+	}
+
+	for _, r := range u.Messages {
+		msg = msg.add(r.Date)
+	}
+
+	for _, r := range u.Megabytes {
+		meg = meg.add(r.Date)
+	}
+
+	return map[string]DateRange{CategoryMinutes: min, CategoryMessages: msg, CategoryMegabytes: meg}
+}
+
+// DateRange returns the DateRange of every row in u.
+func (u Usage) DateRange() DateRange {
+	var all DateRange
+
+	for _, r := range u.DateRanges() {
+		if !r.IsZero() {
+			all = all.add(r.First).add(r.Last)
+		}
+	}
+
+	return all
+}
+
+// WithUsagePeriod returns bil with the gaps filled in from the dates in u. Without periodStart
+// and periodEnd, the billing period is the first and last days of usage, and without a
+// description, it's made from the billing period, like "Ting 2019-09-03..2019-10-02". It also
+// warns if the usage csv files cover different dates.
+func WithUsagePeriod(bil tingbill.Bill, u Usage) (tingbill.Bill, []tingbill.Warning) {
+	var warnings []tingbill.Warning
+
+	ranges := u.DateRanges()
+	all := u.DateRange()
+
+	if bil.PeriodStart.IsZero() && !all.IsZero() {
+		bil.PeriodStart = tingbill.Date{Time: day(all.First)}
+		bil.PeriodEnd = tingbill.Date{Time: day(all.Last)}
+
+		warnings = append(warnings, tingbill.Warning{
+			Code:     WarnDerivedPeriod,
+			Severity: tingbill.SeverityInfo,
+			Message:  fmt.Sprintf("bill doesn't have periodStart and periodEnd, using %s to %s from the usage csv files", bil.PeriodStart, bil.PeriodEnd),
+			Context:  map[string]string{"periodStart": bil.PeriodStart.String(), "periodEnd": bil.PeriodEnd.String()},
+		})
+	}
+
+	if bil.Description == "" && !bil.PeriodStart.IsZero() {
+		bil.Description = fmt.Sprintf("Ting %s..%s", bil.PeriodStart, bil.PeriodEnd)
+	}
+
+	var spans []string
+	consistent := true
+	context := make(map[string]string)
+
+	for _, category := range []string{CategoryMinutes, CategoryMessages, CategoryMegabytes} {
+		r := ranges[category]
+		if r.IsZero() {
+			continue
+		}
+
+		if day(r.First).Sub(day(all.First)) > dateRangeSlack || day(all.Last).Sub(day(r.Last)) > dateRangeSlack {
+			consistent = false
+		}
+
+		spans = append(spans, category+" "+r.String())
+		context[category] = r.String()
+	}
+
+	if !consistent {
+		warnings = append(warnings, tingbill.Warning{
+			Code:     WarnDateRanges,
+			Severity: tingbill.SeverityWarning,
+			Message:  fmt.Sprintf("usage csv files cover different dates, check they're all for the same billing period: %s", strings.Join(spans, ", ")),
+			Context:  context,
+		})
+	}
+
+	return bil, warnings
+}
+
+// day returns the start of the day t is on.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,94 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+)
+
+// normalizeDeviceIds rewrites every deviceId in b, including the shortStrawId, deviceId charges
+// and credits, and the keys of weights, in the form tingbill.NormalizePhone returns, so they
+// match the usage csv files however they're written. Two devices with the same phone number are
+// an error.
+func normalizeDeviceIds(b *tingbill.Bill) error {
+	written := make(map[string]string)
+
+	for i, d := range b.Devices {
+		id, err := tingbill.NormalizePhone(d.DeviceID)
+		if err != nil {
+			return fmt.Errorf("devices[%d] deviceId: %w", i, err)
+		}
+
+		if other, exists := written[id]; exists {
+			if other == d.DeviceID {
+				return fmt.Errorf("deviceId %s is on the bill more than once", d.DeviceID)
+			}
+			return fmt.Errorf("deviceIds %q and %q are the same phone number", other, d.DeviceID)
+		}
+
+		written[id] = d.DeviceID
+		b.Devices[i].DeviceID = id
+	}
+
+	if b.ShortStrawID != "" {
+		id, err := tingbill.NormalizePhone(b.ShortStrawID)
+		if err != nil {
+			return fmt.Errorf("shortStrawId: %w", err)
+		}
+		b.ShortStrawID = id
+	}
+
+	// Weights in split policies are keyed by deviceId
+	type namedPolicy struct {
+		name string
+		p    *tingbill.SplitPolicy
+	}
+
+	policies := []namedPolicy{
+		{"split.minutes", &b.Split.Minutes},
+		{"split.messages", &b.Split.Messages},
+		{"split.megabytes", &b.Split.Megabytes},
+		{"split.devices", &b.Split.Devices},
+		{"split.fees", &b.Split.Fees},
+	}
+
+	for _, kind := range []struct {
+		name    string
+		charges []tingbill.Charge
+	}{
+		{"charge", b.Charges},
+		{"credit", b.Credits},
+	} {
+		for i := range kind.charges {
+			c := &kind.charges[i]
+
+			if c.DeviceID != "" {
+				id, err := tingbill.NormalizePhone(c.DeviceID)
+				if err != nil {
+					return fmt.Errorf("%s %q deviceId: %w", kind.name, c.Name, err)
+				}
+				c.DeviceID = id
+			}
+
+			policies = append(policies, namedPolicy{fmt.Sprintf("%s %q", kind.name, c.Name), &c.SplitPolicy})
+		}
+	}
+
+	for _, policy := range policies {
+		if len(policy.p.Weights) == 0 {
+			continue
+		}
+
+		weights := make(tingbill.Weights)
+		for _, key := range policy.p.Weights.Keys() {
+			id, err := tingbill.NormalizePhone(key)
+			if err != nil {
+				return fmt.Errorf("%s weights: %w", policy.name, err)
+			}
+			weights[id] = policy.p.Weights[key]
+		}
+		policy.p.Weights = weights
+	}
+
+	return nil
+}
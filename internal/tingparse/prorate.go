@@ -0,0 +1,108 @@
+package tingparse
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// ProratedStrategy scales the weights of another AllocationStrategy by how much of the billing
+// period each device was active. It's used for the devicesCost and fees categories.
+type ProratedStrategy struct {
+	Strategy AllocationStrategy
+	Factors  map[string]decimal.Decimal
+}
+
+// Weights returns the wrapped strategy's weights, multiplied by each device's proration factor.
+func (s ProratedStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w, err := s.Strategy.Weights(ids, usage)
+	if err != nil {
+		return w, err
+	}
+
+	for _, id := range ids {
+		if f, ok := s.Factors[id]; ok {
+			w[id] = w[id].Mul(f)
+		}
+	}
+
+	return w, nil
+}
+
+// checkPeriod makes sure the billing period and any device activity dates in bill.toml make sense.
+// Activity dates also need a billing period, but it can be taken from the usage csv files, so
+// that's left to checkActivePeriod.
+func checkPeriod(b tingbill.Bill) error {
+	if b.PeriodStart.IsZero() != b.PeriodEnd.IsZero() {
+		return errors.New("periodStart and periodEnd must be set together")
+	}
+
+	if !b.PeriodStart.IsZero() && b.PeriodEnd.Before(b.PeriodStart.Time) {
+		return fmt.Errorf("periodEnd %s is before periodStart %s", b.PeriodEnd, b.PeriodStart)
+	}
+
+	for _, d := range b.Devices {
+		if !d.ActiveFrom.IsZero() && !d.ActiveTo.IsZero() && d.ActiveTo.Before(d.ActiveFrom.Time) {
+			return fmt.Errorf("deviceId %s has activeTo %s before activeFrom %s", d.DeviceID, d.ActiveTo, d.ActiveFrom)
+		}
+	}
+
+	return nil
+}
+
+// checkActivePeriod makes sure a Bill with device activity dates has a billing period to prorate
+// by. It's checked by CalculateSplit, after WithUsagePeriod has had the chance to fill it in.
+func checkActivePeriod(b tingbill.Bill) error {
+	if !b.PeriodStart.IsZero() {
+		return nil
+	}
+
+	for _, d := range b.Devices {
+		if !d.ActiveFrom.IsZero() || !d.ActiveTo.IsZero() {
+			return fmt.Errorf("deviceId %s has activeFrom or activeTo, which requires periodStart and periodEnd, or dates in the usage csv files to take them from", d.DeviceID)
+		}
+	}
+
+	return nil
+}
+
+// prorationFactors returns the fraction of the billing period each device on the Bill was active,
+// counting whole days, including the first and last. Devices without activity dates, or any device
+// on a Bill without a billing period, have a factor of 1.
+func prorationFactors(bil tingbill.Bill) map[string]decimal.Decimal {
+	factors := make(map[string]decimal.Decimal)
+
+	for _, d := range bil.Devices {
+		factors[d.DeviceID] = decimal.New(1, 0)
+
+		if bil.PeriodStart.IsZero() || (d.ActiveFrom.IsZero() && d.ActiveTo.IsZero()) {
+			continue
+		}
+
+		from := bil.PeriodStart
+		if !d.ActiveFrom.IsZero() && d.ActiveFrom.After(from.Time) {
+			from = d.ActiveFrom
+		}
+
+		to := bil.PeriodEnd
+		if !d.ActiveTo.IsZero() && d.ActiveTo.Before(to.Time) {
+			to = d.ActiveTo
+		}
+
+		activeDays := daysBetween(from, to)
+		if activeDays < 0 {
+			activeDays = 0
+		}
+
+		factors[d.DeviceID] = decimal.New(int64(activeDays), 0).DivRound(decimal.New(int64(daysBetween(bil.PeriodStart, bil.PeriodEnd)), 0), 16)
+	}
+
+	return factors
+}
+
+// daysBetween counts the days from start to end, including both.
+func daysBetween(start tingbill.Date, end tingbill.Date) int {
+	return int(end.Sub(start.Time).Hours()/24) + 1
+}
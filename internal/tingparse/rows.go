@@ -0,0 +1,172 @@
+package tingparse
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// WarnBadRow means a row of a usage csv file couldn't be parsed, and was skipped because the
+// parser was lenient.
+const WarnBadRow = "csv-bad-row"
+
+// ParseOptions changes how ParseMinutes, ParseMessages and ParseMegabytes read a usage csv file.
+// File is the file's name, used in errors, which default to naming the kind of file, like
+// "minutes csv file". When Lenient is true, bad rows are skipped and returned as WarnBadRow
+// warnings, instead of stopping at the first one with an error.
+type ParseOptions struct {
+	File    string
+	Lenient bool
+}
+
+// file returns the name of the file for errors, or a description of it using category.
+func (o ParseOptions) file(category string) string {
+	if o.File == "" {
+		return category + " csv file"
+	}
+
+	return o.File
+}
+
+// ParseError is a problem with a single row of a usage csv file. Line counts the header as
+// line 1. Column is the header of the bad column, and Value what it held, or both are empty
+// if the problem is with the whole row, like it being too short.
+type ParseError struct {
+	File   string
+	Line   int
+	Column string
+	Value  string
+	Err    error
+}
+
+// Error returns the ParseError as a single line of text, like
+// `minutes.csv line 4, column "Duration (min)": "1.5" isn't a whole number`.
+func (e *ParseError) Error() string {
+	s := fmt.Sprintf("%s line %d", e.File, e.Line)
+	if e.Column != "" {
+		s += fmt.Sprintf(", column %q", e.Column)
+	}
+
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the problem with the row, without the file and line.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// badRowWarning returns a WarnBadRow warning for a row that was skipped.
+func badRowWarning(e *ParseError) tingbill.Warning {
+	return tingbill.Warning{
+		Code:     WarnBadRow,
+		Severity: tingbill.SeverityWarning,
+		Message:  e.Error(),
+		Context: map[string]string{
+			"file":   e.File,
+			"line":   strconv.Itoa(e.Line),
+			"column": e.Column,
+			"value":  e.Value,
+		},
+	}
+}
+
+// csvRow is a single row of a usage csv file, along with the header, so problems can name
+// the column they're in.
+type csvRow struct {
+	header []string
+	record []string
+}
+
+// fail returns a ParseError for the value in column index. readRows fills in the file and line.
+func (row csvRow) fail(index int, err error) error {
+	return &ParseError{Column: row.header[index], Value: row.record[index], Err: err}
+}
+
+// int returns the whole number in column index.
+func (row csvRow) int(index int) (int, error) {
+	n, err := strconv.Atoi(row.record[index])
+	if err != nil {
+		return 0, row.fail(index, fmt.Errorf("%q isn't a whole number", row.record[index]))
+	}
+
+	return n, nil
+}
+
+// phone returns the phone number in column index, normalized by tingbill.NormalizePhone.
+func (row csvRow) phone(index int) (string, error) {
+	id, err := tingbill.NormalizePhone(row.record[index])
+	if err != nil {
+		return "", row.fail(index, err)
+	}
+
+	return id, nil
+}
+
+// surcharge returns the surcharge in column index, see parseSurcharge.
+func (row csvRow) surcharge(index int) (decimal.Decimal, error) {
+	surcharge, err := parseSurcharge(row.record, index)
+	if err != nil {
+		return decimal.Zero, row.fail(index, err)
+	}
+
+	return surcharge, nil
+}
+
+// readRows calls parse with every row of a usage csv file after the header. Rows with fewer
+// than width columns are bad without calling parse, so it can index the columns it needs. The
+// first bad row is returned as a *ParseError, unless lenient is true, in which case every bad
+// row is skipped and returned as a WarnBadRow warning.
+func readRows(r *csv.Reader, file string, lenient bool, header []string, width int, parse func(row csvRow) error) ([]tingbill.Warning, error) {
+	var warnings []tingbill.Warning
+
+	// Row widths are checked here, so short rows are reported like any other bad row
+	r.FieldsPerRecord = -1
+
+	line := 1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return warnings, nil
+		}
+		line++
+
+		if err == nil && len(record) < width {
+			err = fmt.Errorf("row has %d columns, expected at least %d", len(record), width)
+		}
+
+		if err == nil {
+			err = parse(csvRow{header, record})
+		}
+
+		if err == nil {
+			continue
+		}
+
+		var pe *ParseError
+		var ce *csv.ParseError
+
+		switch {
+		case errors.As(err, &pe):
+		case errors.As(err, &ce):
+			// The csv reader knows the real line, which can be off when a value spans lines
+			line = ce.Line
+			pe = &ParseError{Err: ce.Err}
+		default:
+			pe = &ParseError{Err: err}
+		}
+
+		pe.File = file
+		pe.Line = line
+
+		if !lenient {
+			return warnings, pe
+		}
+
+		warnings = append(warnings, badRowWarning(pe))
+	}
+}
@@ -0,0 +1,163 @@
+package tingparse
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// ShapleyExactLimit is the largest number of devices ShapleyStrategy computes exact values for.
+// Bigger plans are approximated by sampling orderings of the devices.
+const ShapleyExactLimit = 10
+
+// ShapleyDefaultSamples is how many orderings ShapleyStrategy samples when a policy doesn't set
+// `samples`.
+const ShapleyDefaultSamples = 2000
+
+// shapleySeed keeps sampled values the same every time a bill is calculated.
+const shapleySeed = 1
+
+// ShapleyStrategy splits a cost by each device's Shapley value - its marginal cost under the
+// tier table, averaged over every order the devices could have joined the plan in. Unlike
+// "tiered", it doesn't matter who is considered the heaviest user, every device is treated the
+// same way.
+type ShapleyStrategy struct {
+	Tiers   []tingbill.Tier
+	Samples int
+}
+
+// Weights returns each device's Shapley value, which CalculateSplit then scales to the actual
+// cost of the category on the Bill.
+func (s ShapleyStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	if usage == nil {
+		return w, fmt.Errorf("%q strategy requires usage data", StrategyShapley)
+	}
+
+	if len(ids) <= ShapleyExactLimit {
+		w = s.exact(ids, usage)
+	} else {
+		w = s.sampled(ids, usage)
+	}
+
+	// Nothing reached a paid tier, so fall back to splitting by usage
+	total := decimal.Zero
+	for _, id := range ids {
+		total = total.Add(w[id])
+	}
+
+	if total.IsZero() {
+		return ProportionalStrategy{}.Weights(ids, usage)
+	}
+
+	return w, nil
+}
+
+// exact computes Shapley values by going through every coalition of devices.
+func (s ShapleyStrategy) exact(ids []string, usage map[string]decimal.Decimal) map[string]decimal.Decimal {
+	w := make(map[string]decimal.Decimal)
+	n := len(ids)
+
+	// Cost of every coalition, indexed by a bitmask of ids
+	costs := make([]decimal.Decimal, 1<<uint(n))
+	sizes := make([]int, 1<<uint(n))
+	for mask := 1; mask < len(costs); mask++ {
+		used := decimal.Zero
+		for i := 0; i < n; i++ {
+			if mask&(1<<uint(i)) != 0 {
+				used = used.Add(usage[ids[i]])
+				sizes[mask]++
+			}
+		}
+		costs[mask] = tierCost(s.Tiers, used)
+	}
+
+	// A coalition of size k is followed by a device in k!(n-k-1)!/n! of all orderings
+	coefs := make([]decimal.Decimal, n)
+	for k := range coefs {
+		coefs[k] = factorial(k).Mul(factorial(n-k-1)).DivRound(factorial(n), 16)
+	}
+
+	for i, id := range ids {
+		bit := 1 << uint(i)
+		value := decimal.Zero
+
+		for mask := range costs {
+			if mask&bit != 0 {
+				continue
+			}
+
+			marginal := costs[mask|bit].Sub(costs[mask])
+			value = value.Add(coefs[sizes[mask]].Mul(marginal))
+		}
+
+		w[id] = value
+	}
+
+	return w
+}
+
+// sampled approximates Shapley values by averaging marginal costs over random orderings of
+// the devices. The same seed is always used, so a bill always splits the same way.
+func (s ShapleyStrategy) sampled(ids []string, usage map[string]decimal.Decimal) map[string]decimal.Decimal {
+	w := make(map[string]decimal.Decimal)
+
+	samples := s.Samples
+	if samples <= 0 {
+		samples = ShapleyDefaultSamples
+	}
+
+	for _, id := range ids {
+		w[id] = decimal.Zero
+	}
+
+	r := rand.New(rand.NewSource(shapleySeed))
+
+	for n := 0; n < samples; n++ {
+		used := decimal.Zero
+		before := decimal.Zero
+
+		for _, i := range r.Perm(len(ids)) {
+			used = used.Add(usage[ids[i]])
+			after := tierCost(s.Tiers, used)
+			w[ids[i]] = w[ids[i]].Add(after.Sub(before))
+			before = after
+		}
+	}
+
+	for _, id := range ids {
+		w[id] = w[id].DivRound(decimal.New(int64(samples), 0), 16)
+	}
+
+	return w
+}
+
+// tierCost returns the price of the smallest tier that fits used, or the biggest tier if none
+// do. No usage costs nothing.
+func tierCost(tiers []tingbill.Tier, used decimal.Decimal) decimal.Decimal {
+	if used.IsZero() {
+		return decimal.Zero
+	}
+
+	for _, t := range tiers {
+		if used.LessThanOrEqual(decimal.New(int64(t.UpTo), 0)) {
+			return t.Cost
+		}
+	}
+
+	return tiers[len(tiers)-1].Cost
+}
+
+// factorial returns n! as a decimal.Decimal.
+func factorial(n int) decimal.Decimal {
+	f := decimal.New(1, 0)
+
+	for i := 2; i <= n; i++ {
+		f = f.Mul(decimal.New(int64(i), 0))
+	}
+
+	return f
+}
@@ -0,0 +1,181 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// Names of the built-in allocation strategies, used as `strategy` in a bill.toml `[split.*]` table.
+const (
+	StrategyEven         = "even"
+	StrategyProportional = "proportional"
+	StrategyWeighted     = "weighted"
+	StrategyHybrid       = "hybrid"
+	StrategyTiered       = "tiered"
+	StrategyShapley      = "shapley"
+)
+
+// StrategyDevice is reported for a Charge attached to a single deviceId. It can't be selected
+// as a strategy in bill.toml, set the charge's `deviceId` instead.
+const StrategyDevice = "device"
+
+// AllocationStrategy decides how a single cost category is divided between devices.
+// Weights returns a relative weight for every id, which CalculateSplit then turns into
+// cent-exact shares of the category's cost. usage is nil for categories which aren't
+// based on usage, like devicesCost and fees. It can be fractional, like with weighted counting.
+type AllocationStrategy interface {
+	Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error)
+}
+
+// decimalUsage returns whole number usage, like kilobytes, as usage for an AllocationStrategy.
+func decimalUsage(usage map[string]int) map[string]decimal.Decimal {
+	if usage == nil {
+		return nil
+	}
+
+	d := make(map[string]decimal.Decimal)
+	for id, v := range usage {
+		d[id] = decimal.New(int64(v), 0)
+	}
+
+	return d
+}
+
+// EvenStrategy splits a cost evenly between every device.
+type EvenStrategy struct{}
+
+// Weights gives every device a weight of 1.
+func (EvenStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	for _, id := range ids {
+		w[id] = decimal.New(1, 0)
+	}
+
+	return w, nil
+}
+
+// ProportionalStrategy splits a cost by how much each device used.
+type ProportionalStrategy struct{}
+
+// Weights uses each device's usage as its weight.
+func (ProportionalStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	if usage == nil {
+		return w, fmt.Errorf("%q strategy requires usage data", StrategyProportional)
+	}
+
+	for _, id := range ids {
+		w[id] = usage[id]
+	}
+
+	return w, nil
+}
+
+// WeightedStrategy splits a cost using fixed, user-provided weights for each device.
+type WeightedStrategy struct {
+	DeviceWeights map[string]decimal.Decimal
+}
+
+// Weights returns the configured weight for each device. Every device must have one.
+func (s WeightedStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	for _, id := range ids {
+		v, ok := s.DeviceWeights[id]
+		if !ok {
+			return w, fmt.Errorf("%q strategy is missing a weight for deviceId %s", StrategyWeighted, id)
+		}
+		w[id] = v
+	}
+
+	return w, nil
+}
+
+// HybridStrategy splits EvenPercent of a cost evenly, and the rest by usage.
+// This effectively puts a floor under what each device pays for a category.
+type HybridStrategy struct {
+	EvenPercent decimal.Decimal
+}
+
+// Weights blends an even weight with each device's fraction of the total usage.
+func (s HybridStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	if usage == nil {
+		return w, fmt.Errorf("%q strategy requires usage data", StrategyHybrid)
+	}
+
+	used := decimal.Zero
+	for _, id := range ids {
+		used = used.Add(usage[id])
+	}
+
+	hundred := decimal.New(100, 0)
+	evenPart := s.EvenPercent.Div(hundred).DivRound(decimal.New(int64(len(ids)), 0), 16)
+	usagePart := hundred.Sub(s.EvenPercent).Div(hundred)
+
+	for _, id := range ids {
+		w[id] = evenPart
+		if used.IsPositive() {
+			w[id] = w[id].Add(usagePart.Mul(usage[id]).DivRound(used, 16))
+		}
+	}
+
+	return w, nil
+}
+
+// NewStrategy returns the AllocationStrategy selected by a tingbill.SplitPolicy.
+// If the policy doesn't name a strategy, defaultStrategy is used.
+func NewStrategy(p tingbill.SplitPolicy, defaultStrategy string) (AllocationStrategy, error) {
+	name := p.Strategy
+	if name == "" {
+		name = defaultStrategy
+	}
+
+	switch name {
+	case StrategyEven:
+		return EvenStrategy{}, nil
+	case StrategyProportional:
+		return ProportionalStrategy{}, nil
+	case StrategyWeighted:
+		if len(p.Weights) == 0 {
+			return nil, fmt.Errorf("%q strategy requires weights", StrategyWeighted)
+		}
+
+		for id, v := range p.Weights {
+			if v.IsNegative() {
+				return nil, fmt.Errorf("%q strategy weight for deviceId %s can't be negative", StrategyWeighted, id)
+			}
+		}
+
+		return WeightedStrategy{DeviceWeights: p.Weights}, nil
+	case StrategyHybrid:
+		if p.EvenPercent.IsNegative() || p.EvenPercent.GreaterThan(decimal.New(100, 0)) {
+			return nil, fmt.Errorf("%q strategy evenPercent must be between 0 and 100, got %v", StrategyHybrid, p.EvenPercent)
+		}
+
+		return HybridStrategy{EvenPercent: p.EvenPercent}, nil
+	case StrategyTiered:
+		if err := checkTiers(p.Tiers); err != nil {
+			return nil, fmt.Errorf("%q strategy: %w", StrategyTiered, err)
+		}
+
+		return TieredStrategy{Tiers: p.Tiers}, nil
+	case StrategyShapley:
+		if err := checkTiers(p.Tiers); err != nil {
+			return nil, fmt.Errorf("%q strategy: %w", StrategyShapley, err)
+		}
+
+		if p.Samples < 0 {
+			return nil, fmt.Errorf("%q strategy samples can't be negative, got %d", StrategyShapley, p.Samples)
+		}
+
+		return ShapleyStrategy{Tiers: p.Tiers, Samples: p.Samples}, nil
+	default:
+		return nil, fmt.Errorf("unknown split strategy %q", name)
+	}
+}
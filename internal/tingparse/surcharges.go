@@ -0,0 +1,111 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// surchargeHeader is the header of the surcharges column in every usage csv file
+const surchargeHeader = "Surcharges ($)"
+
+// Shared costs the surcharges from the usage csv files can be included in on the Ting bill.
+// Set with `surchargesFrom` in bill.toml.
+const (
+	// SurchargesFromFees takes surcharges out of the fees. This is the default.
+	SurchargesFromFees = "fees"
+	// SurchargesFromDevices takes surcharges out of the devicesCost.
+	SurchargesFromDevices = "devicesCost"
+)
+
+// validSurchargesFrom returns true if p is empty (use the default) or a known shared cost.
+func validSurchargesFrom(p string) bool {
+	return p == "" || p == SurchargesFromFees || p == SurchargesFromDevices
+}
+
+// parseSurcharge returns the surcharge in column index of a csv record. A missing column,
+// or an empty value, is no surcharge.
+func parseSurcharge(record []string, index int) (decimal.Decimal, error) {
+	if index < 0 || index >= len(record) || record[index] == "" {
+		return decimal.Zero, nil
+	}
+
+	surcharge, err := decimal.NewFromString(record[index])
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%q isn't a valid surcharge", record[index])
+	}
+
+	return surcharge, nil
+}
+
+// surchargeUsage totals the surcharges in every row of u for each device, keyed by deviceId.
+func surchargeUsage(u Usage) map[string]decimal.Decimal {
+	m := make(map[string]decimal.Decimal)
+
+	for _, r := range u.Minutes {
+		m[r.DeviceID] = m[r.DeviceID].Add(r.Surcharge)
+	}
+
+	for _, r := range u.Messages {
+		m[r.DeviceID] = m[r.DeviceID].Add(r.Surcharge)
+	}
+
+	for _, r := range u.Megabytes {
+		m[r.DeviceID] = m[r.DeviceID].Add(r.Surcharge)
+	}
+
+	return m
+}
+
+// splitSurcharges charges each of the Bill's devices its own surcharges from u, and returns the
+// shared devicesCost and fees with the surcharges taken out of the one named by the Bill's
+// SurchargesFrom. Surcharges for devices which aren't on the Bill are left out.
+func splitSurcharges(u Usage, bs *tingbill.BillSplit, bil tingbill.Bill) (decimal.Decimal, decimal.Decimal, error) {
+	devicesCost, fees := bil.DevicesCost, bil.Fees
+	usage := surchargeUsage(u)
+
+	var charged []string
+	total := decimal.Zero
+	weights := make(map[string]decimal.Decimal)
+
+	for _, id := range bil.DeviceIds() {
+		bs.SurchargeCosts[id] = decimal.Zero
+
+		if !usage[id].IsZero() {
+			charged = append(charged, id)
+			weights[id] = usage[id]
+			total = total.Add(usage[id])
+		}
+	}
+
+	if len(charged) == 0 {
+		return devicesCost, fees, nil
+	}
+
+	// Each device's weight is its own surcharges, so nothing is actually split
+	a, err := allocate(total, charged, weights, RemainderLargest, charged[0])
+	if err != nil {
+		return devicesCost, fees, err
+	}
+
+	for _, id := range charged {
+		bs.SurchargeCosts[id] = a.Shares[id]
+	}
+	recordSplit(bs, "Surcharges", StrategyDevice, nil, a)
+
+	switch bil.SurchargesFrom {
+	case SurchargesFromDevices:
+		if total.GreaterThan(devicesCost) {
+			return devicesCost, fees, fmt.Errorf("surcharges of $%s are more than devicesCost of $%s they're taken out of", total.StringFixed(CentPrecision), devicesCost.StringFixed(CentPrecision))
+		}
+		devicesCost = devicesCost.Sub(total)
+	default:
+		if total.GreaterThan(fees) {
+			return devicesCost, fees, fmt.Errorf("surcharges of $%s are more than fees of $%s they're taken out of, set surchargesFrom if they're included in devicesCost", total.StringFixed(CentPrecision), fees.StringFixed(CentPrecision))
+		}
+		fees = fees.Sub(total)
+	}
+
+	return devicesCost, fees, nil
+}
@@ -0,0 +1,116 @@
+package tingparse
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// TieredStrategy splits a cost using Ting's tier buckets. The cost of the base tier is split
+// proportionally by usage. The extra cost of each tier above it is charged only to the devices
+// whose usage pushed the plan into that tier.
+//
+// To decide who pushed the plan into a tier, usage is stacked from the lightest device to the
+// heaviest. Each device's slice of the stack above a tier's threshold decides its share of
+// that tier's extra cost. A light user never pays for a tier a heavy user caused.
+type TieredStrategy struct {
+	Tiers []tingbill.Tier
+}
+
+// Weights returns each device's cost under the tier table, which CalculateSplit then scales to
+// the actual cost of the category on the Bill.
+func (s TieredStrategy) Weights(ids []string, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	w := make(map[string]decimal.Decimal)
+
+	if usage == nil {
+		return w, fmt.Errorf("%q strategy requires usage data", StrategyTiered)
+	}
+
+	used := decimal.Zero
+	for _, id := range ids {
+		used = used.Add(usage[id])
+	}
+
+	for _, id := range ids {
+		w[id] = decimal.Zero
+		if used.IsPositive() {
+			w[id] = s.Tiers[0].Cost.Mul(usage[id]).DivRound(used, 16)
+		}
+	}
+
+	// Stack usage from the lightest device to the heaviest, ties keep Bill order
+	order := make([]string, len(ids))
+	copy(order, ids)
+	sort.SliceStable(order, func(i, j int) bool { return usage[order[i]].LessThan(usage[order[j]]) })
+
+	starts := make(map[string]decimal.Decimal)
+	stacked := decimal.Zero
+	for _, id := range order {
+		starts[id] = stacked
+		stacked = stacked.Add(usage[id])
+	}
+
+	for k := 1; k < len(s.Tiers); k++ {
+		threshold := decimal.New(int64(s.Tiers[k-1].UpTo), 0)
+		if used.LessThanOrEqual(threshold) {
+			break
+		}
+
+		extra := s.Tiers[k].Cost.Sub(s.Tiers[k-1].Cost)
+		above := used.Sub(threshold)
+
+		for _, id := range ids {
+			start := starts[id]
+			if start.LessThan(threshold) {
+				start = threshold
+			}
+
+			if overlap := starts[id].Add(usage[id]).Sub(start); overlap.IsPositive() {
+				w[id] = w[id].Add(extra.Mul(overlap).DivRound(above, 16))
+			}
+		}
+	}
+
+	// Everything fit in a free base tier, so fall back to splitting by usage
+	total := decimal.Zero
+	for _, id := range ids {
+		total = total.Add(w[id])
+	}
+
+	if total.IsZero() {
+		return ProportionalStrategy{}.Weights(ids, usage)
+	}
+
+	return w, nil
+}
+
+// checkTiers makes sure a tier table has at least one tier, and that both usage limits
+// and costs only go up from one tier to the next.
+func checkTiers(tiers []tingbill.Tier) error {
+	if len(tiers) == 0 {
+		return errors.New("at least one tier is required")
+	}
+
+	for i, t := range tiers {
+		if t.UpTo < 0 || t.Cost.IsNegative() {
+			return fmt.Errorf("tier %d can't have a negative upTo or cost", i+1)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		if t.UpTo <= tiers[i-1].UpTo {
+			return fmt.Errorf("tier %d upTo %d must be more than the tier before it", i+1, t.UpTo)
+		}
+
+		if t.Cost.LessThan(tiers[i-1].Cost) {
+			return fmt.Errorf("tier %d cost %s can't be less than the tier before it", i+1, t.Cost)
+		}
+	}
+
+	return nil
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/hitjim/ting-bill-split/internal/tingbill"
@@ -21,15 +25,121 @@ func sliceIndex(limit int, predicate func(i int) bool) int {
 	return -1
 }
 
+// Categories a Charge from bill.toml can belong to
+const (
+	CategoryMinutes   = "minutes"
+	CategoryMessages  = "messages"
+	CategoryMegabytes = "megabytes"
+	CategoryShared    = "shared"
+)
+
+// billAmountKeys are the keys in bill.toml holding US Dollar amounts
+var billAmountKeys = []string{
+	"total",
+	"devicesCost",
+	"minutes",
+	"messages",
+	"megabytes",
+	"extraMinutes",
+	"extraMessages",
+	"extraMegabytes",
+	"fees",
+}
+
+var amountPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decodeAmount accepts a value decoded from bill.toml and returns it as a decimal.Decimal.
+// Integers (`48`), floats (`48.00`) and strings (`"48.00"`) are accepted. Anything else,
+// including strings with currency symbols or separators like `"$48"` or `"1,048.00"`, is an error.
+func decodeAmount(v interface{}) (decimal.Decimal, error) {
+	switch a := v.(type) {
+	case nil:
+		return decimal.Zero, errors.New("missing amount")
+	case int64:
+		return decimal.New(a, 0), nil
+	case float64:
+		return decimal.NewFromString(strconv.FormatFloat(a, 'f', -1, 64))
+	case string:
+		if !amountPattern.MatchString(a) {
+			return decimal.Zero, fmt.Errorf(`invalid amount %q, expected a number like 48, 48.00 or "48.00"`, a)
+		}
+		return decimal.NewFromString(a)
+	default:
+		return decimal.Zero, fmt.Errorf(`invalid amount %v, expected a number like 48, 48.00 or "48.00"`, v)
+	}
+}
+
 // ParseBill accepts an io.Reader from a bill.toml file, and returns a tingbill.Bill
 // with relevant data, or an error. The data is later used to calculate cost splits
 // against device usage.
 func ParseBill(r io.Reader) (tingbill.Bill, error) {
 	var b tingbill.Bill
-	if _, err := toml.DecodeReader(r, &b); err != nil {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
 		return tingbill.Bill{}, err
 	}
 
+	// Check amounts up front, so a bad value is reported with the key it belongs to
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	for _, key := range billAmountKeys {
+		if v, exists := raw[key]; exists {
+			if _, err := decodeAmount(v); err != nil {
+				return tingbill.Bill{}, fmt.Errorf("bill %s: %w", key, err)
+			}
+		}
+	}
+
+	if devices, ok := raw["devices"].([]map[string]interface{}); ok {
+		for i, d := range devices {
+			if err := checkLimitAmounts(d); err != nil {
+				return tingbill.Bill{}, fmt.Errorf("bill devices[%d] %v: %w", i, d["deviceId"], err)
+			}
+		}
+	}
+
+	if owners, ok := raw["owners"].(map[string]interface{}); ok {
+		for owner, o := range owners {
+			if l, ok := o.(map[string]interface{}); ok {
+				if err := checkLimitAmounts(l); err != nil {
+					return tingbill.Bill{}, fmt.Errorf("bill owners.%s: %w", owner, err)
+				}
+			}
+		}
+	}
+
+	if international, ok := raw["international"].(map[string]interface{}); ok {
+		for _, key := range internationalAmountKeys {
+			if v, exists := international[key]; exists {
+				if _, err := decodeAmount(v); err != nil {
+					return tingbill.Bill{}, fmt.Errorf("bill international %s: %w", key, err)
+				}
+			}
+		}
+	}
+
+	for _, key := range []string{"charges", "credits"} {
+		if charges, ok := raw[key].([]map[string]interface{}); ok {
+			for i, c := range charges {
+				if _, err := decodeAmount(c["amount"]); err != nil {
+					return tingbill.Bill{}, fmt.Errorf("bill %s[%d] %v amount: %w", key, i, c["name"], err)
+				}
+			}
+		}
+	}
+
+	if _, err := toml.Decode(string(data), &b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := normalizeDeviceIds(&b); err != nil {
+		return tingbill.Bill{}, fmt.Errorf("bill %w", err)
+	}
+
 	ids := b.DeviceIds()
 
 	// Check to see if a shortStrawId was set. If not, set it to first one we find.
@@ -41,292 +151,984 @@ func ParseBill(r io.Reader) (tingbill.Bill, error) {
 		b.ShortStrawID = ids[0]
 	}
 
+	if !validRemainderPolicy(b.RemainderPolicy) {
+		return tingbill.Bill{}, fmt.Errorf(`unknown remainderPolicy %q, expected %q or %q`, b.RemainderPolicy, RemainderLargest, RemainderShortStraw)
+	}
+
+	if !validZeroUsagePolicy(b.ZeroUsagePolicy) {
+		return tingbill.Bill{}, fmt.Errorf(`unknown zeroUsagePolicy %q, expected %q, %q or %q`, b.ZeroUsagePolicy, ZeroUsageEven, ZeroUsageShortStraw, ZeroUsageShared)
+	}
+
+	if err := checkPeriod(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkPayers(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkLimits(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if !validSurchargesFrom(b.SurchargesFrom) {
+		return tingbill.Bill{}, fmt.Errorf("unknown surchargesFrom %q, expected %q or %q", b.SurchargesFrom, SurchargesFromFees, SurchargesFromDevices)
+	}
+
+	if err := checkUnknownDevices(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkCounting(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkInternational(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkNetworkWeights(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkSplitPolicies(b); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkCharges(b, b.Charges, "charge"); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	if err := checkCharges(b, b.Credits, "credit"); err != nil {
+		return tingbill.Bill{}, err
+	}
+
+	for _, c := range b.Credits {
+		if c.Amount.IsNegative() {
+			return tingbill.Bill{}, fmt.Errorf("credit %q amount should be positive, credits are subtracted from the bill", c.Name)
+		}
+	}
+
 	return b, nil
 }
 
-// ParseMinutes accepts an io.Reader from a minutes csv file, and returns a map containing
-// usage data, or an error. The map's keys are `deviceID`s and the value is how many
-// minutes that device used in the billable month.
-func ParseMinutes(minReader io.Reader) (map[string]int, error) {
-	m := make(map[string]int)
+// checkPayers makes sure the payer shares of every device in bill.toml add up to 100%.
+func checkPayers(b tingbill.Bill) error {
+	hundred := decimal.New(100, 0)
+
+	for _, d := range b.Devices {
+		if len(d.Payers) == 0 {
+			continue
+		}
+
+		sum := decimal.Zero
+		for p, share := range d.Payers {
+			if !share.IsPositive() {
+				return fmt.Errorf("deviceId %s payer %q must have a share above 0, got %s", d.DeviceID, p, share)
+			}
+			sum = sum.Add(share)
+		}
+
+		if !sum.Equal(hundred) {
+			return fmt.Errorf("deviceId %s payer shares add up to %s%%, they must add up to 100%%", d.DeviceID, sum)
+		}
+	}
+
+	return nil
+}
+
+// checkSplitPolicies makes sure every `[split.*]` table in bill.toml selects a usable strategy,
+// so mistakes are reported before any usage data is read.
+func checkSplitPolicies(b tingbill.Bill) error {
+	usageBased := map[string]tingbill.SplitPolicy{
+		"minutes":   b.Split.Minutes,
+		"messages":  b.Split.Messages,
+		"megabytes": b.Split.Megabytes,
+	}
+
+	for name, p := range usageBased {
+		s, err := NewStrategy(p, StrategyProportional)
+		if err == nil {
+			_, err = s.Weights(b.DeviceIds(), map[string]decimal.Decimal{})
+		}
+		if err != nil {
+			return fmt.Errorf("split.%s: %w", name, err)
+		}
+	}
+
+	shared := map[string]tingbill.SplitPolicy{
+		"devices": b.Split.Devices,
+		"fees":    b.Split.Fees,
+	}
+
+	for name, p := range shared {
+		s, err := NewStrategy(p, StrategyEven)
+		if err == nil {
+			_, err = s.Weights(b.DeviceIds(), nil)
+		}
+		if err != nil {
+			return fmt.Errorf("split.%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkCharges makes sure every `[[charges]]` or `[[credits]]` entry in bill.toml has a name,
+// and either belongs to a known device or owner, or has a known category and a usable strategy.
+// kind is only used to describe the entry in errors.
+func checkCharges(b tingbill.Bill, charges []tingbill.Charge, kind string) error {
+	for i, c := range charges {
+		if c.Name == "" {
+			return fmt.Errorf("%ss[%d] is missing a name", kind, i)
+		}
+
+		if c.DeviceID != "" && c.Owner != "" {
+			return fmt.Errorf("%s %q can have a deviceId or an owner, but not both", kind, c.Name)
+		}
+
+		// Charges attached to a single device skip the split entirely
+		if c.DeviceID != "" {
+			if sliceIndex(len(b.Devices), func(i int) bool { return b.Devices[i].DeviceID == c.DeviceID }) < 0 {
+				return fmt.Errorf("%s %q has deviceId %s, which isn't one of the bill's devices", kind, c.Name, c.DeviceID)
+			}
+			if c.Strategy != "" {
+				return fmt.Errorf("%s %q has a deviceId, so it can't also have a strategy", kind, c.Name)
+			}
+			continue
+		}
+
+		ids := b.DeviceIds()
+		if c.Owner != "" {
+			ids = b.DeviceIdsByOwner(c.Owner)
+			if len(ids) == 0 {
+				return fmt.Errorf("%s %q has owner %q, who doesn't own any of the bill's devices", kind, c.Name, c.Owner)
+			}
+		}
+
+		switch c.Category {
+		case CategoryMinutes, CategoryMessages, CategoryMegabytes, CategoryShared:
+		case "":
+			if c.Owner == "" {
+				return fmt.Errorf("%s %q is missing a category", kind, c.Name)
+			}
+		default:
+			return fmt.Errorf("%s %q has unknown category %q, expected %q, %q, %q or %q",
+				kind, c.Name, c.Category, CategoryMinutes, CategoryMessages, CategoryMegabytes, CategoryShared)
+		}
+
+		usage := map[string]decimal.Decimal{}
+		defaultStrategy := StrategyProportional
+		if c.Category == CategoryShared || c.Category == "" {
+			usage = nil
+			defaultStrategy = StrategyEven
+		}
+
+		s, err := NewStrategy(c.SplitPolicy, defaultStrategy)
+		if err == nil {
+			_, err = s.Weights(ids, usage)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %q: %w", kind, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MinuteRecord is a single row of a minutes csv file. Surcharge is any extra cost Ting charged
+// for the call, which is paid by the device that made it. Country is where the device was, and
+// PartnerCountry is where the other side of the call was. Direction is DirectionOutgoing or
+// DirectionIncoming, or empty if the file doesn't say. Date is when the call was made, or the
+// zero time if the file doesn't say.
+type MinuteRecord struct {
+	DeviceID       string
+	Minutes        int
+	Surcharge      decimal.Decimal
+	Country        string
+	PartnerCountry string
+	Direction      string
+	Date           time.Time
+}
+
+// ParseMinutes accepts an io.Reader from a minutes csv file, and returns a MinuteRecord for
+// each row, any warnings, or an error. A bad row is a *ParseError, see ParseOptions.
+func ParseMinutes(minReader io.Reader, opts ParseOptions) ([]MinuteRecord, []tingbill.Warning, error) {
+	var m []MinuteRecord
 	r := csv.NewReader(minReader)
+	file := opts.file("minutes")
 
 	// Get index of important fields
 	header, err := r.Read()
 
 	if err == io.EOF {
-		fmt.Println("minutes.csv is empty!")
-		return m, err
+		return m, []tingbill.Warning{emptyFileWarning("minutes")}, nil
 	}
 
 	if err != nil {
-		fmt.Println("Error parsing minutes.csv")
-		return m, err
+		return m, nil, fmt.Errorf("parsing %s: %w", file, err)
 	}
 
 	phoneIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Phone" })
 
 	if phoneIndex < 0 {
-		return m, errors.New(`missing "Phone" header in minutes csv file`)
+		return m, nil, fmt.Errorf(`missing "Phone" header in %s`, file)
 	}
 
 	minIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Duration (min)" })
 
 	if minIndex < 0 {
-		return m, errors.New(`missing "Duration (min)" header in minutes csv file`)
+		return m, nil, fmt.Errorf(`missing "Duration (min)" header in %s`, file)
 	}
 
-	for {
-		record, err := r.Read()
+	surchargeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == surchargeHeader })
+	countryIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Country" })
+	partnerCountryIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Partner's Country" })
+	directionIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Incoming/Outgoing" })
+	dateIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Date" })
+	timeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Time" })
 
+	warnings, err := readRows(r, file, opts.Lenient, header, maxIndex(phoneIndex, minIndex)+1, func(row csvRow) error {
+		id, err := row.phone(phoneIndex)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return m, err
+			return err
+		}
+
+		min, err := row.int(minIndex)
+		if err != nil {
+			return err
 		}
 
-		min, err := strconv.Atoi(record[minIndex])
+		surcharge, err := row.surcharge(surchargeIndex)
 		if err != nil {
-			return m, err
+			return err
 		}
 
-		phone := record[phoneIndex]
+		date, err := parseDateTime(row.record, dateIndex, timeIndex)
+		if err != nil {
+			return err
+		}
+
+		m = append(m, MinuteRecord{
+			DeviceID:       id,
+			Minutes:        min,
+			Surcharge:      surcharge,
+			Country:        optionalField(row.record, countryIndex),
+			PartnerCountry: optionalField(row.record, partnerCountryIndex),
+			Direction:      parseDirection(optionalField(row.record, directionIndex)),
+			Date:           date,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return m, warnings, err
+	}
 
-		m[phone] += min
+	if len(m) == 0 {
+		return m, append(warnings, noRowsWarning("minutes")), nil
 	}
 
-	return m, nil
+	return m, warnings, nil
 }
 
-// ParseMessages accepts an io.Reader from a messages csv file, and returns a map containing
-// usage data, or an error. The map's keys are `deviceID`s and the value is how many
-// messages that device used in the billable month.
-func ParseMessages(msgReader io.Reader) (map[string]int, error) {
-	m := make(map[string]int)
+// MessageRecord is a single row of a messages csv file, which is one message. Surcharge is any
+// extra cost Ting charged for the message, which is paid by the device that sent or received it.
+// Roaming is true if the device was roaming in RoamingCountry at the time. Direction is
+// DirectionOutgoing for sent messages and DirectionIncoming for received ones, or empty if the
+// file doesn't say. Date is when the message was sent or received, or the zero time if the
+// file doesn't say.
+type MessageRecord struct {
+	DeviceID       string
+	Surcharge      decimal.Decimal
+	Roaming        bool
+	RoamingCountry string
+	Direction      string
+	Date           time.Time
+}
+
+// ParseMessages accepts an io.Reader from a messages csv file, and returns a MessageRecord for
+// each row, any warnings, or an error. A bad row is a *ParseError, see ParseOptions.
+func ParseMessages(msgReader io.Reader, opts ParseOptions) ([]MessageRecord, []tingbill.Warning, error) {
+	var m []MessageRecord
 	r := csv.NewReader(msgReader)
+	file := opts.file("messages")
 
 	// Get index of important fields
 	header, err := r.Read()
 
 	if err == io.EOF {
-		fmt.Println("messages.csv is empty!")
-		return m, err
+		return m, []tingbill.Warning{emptyFileWarning("messages")}, nil
 	}
 
 	if err != nil {
-		fmt.Println("Error parsing messages.csv")
-		return m, err
+		return m, nil, fmt.Errorf("parsing %s: %w", file, err)
 	}
 
 	phoneIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Phone" })
 
 	if phoneIndex < 0 {
-		return m, errors.New(`missing "Phone" header in messages csv file`)
+		return m, nil, fmt.Errorf(`missing "Phone" header in %s`, file)
 	}
 
-	for {
-		record, err := r.Read()
+	surchargeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == surchargeHeader })
+	roamingIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Roaming" })
+	roamingCountryIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Roaming Country" })
+	directionIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Sent/Received" })
+	dateIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Date" })
+	timeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Time" })
 
+	warnings, err := readRows(r, file, opts.Lenient, header, phoneIndex+1, func(row csvRow) error {
+		id, err := row.phone(phoneIndex)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return m, err
+			return err
+		}
+
+		surcharge, err := row.surcharge(surchargeIndex)
+		if err != nil {
+			return err
 		}
 
-		phone := record[phoneIndex]
+		date, err := parseDateTime(row.record, dateIndex, timeIndex)
+		if err != nil {
+			return err
+		}
+
+		m = append(m, MessageRecord{
+			DeviceID:       id,
+			Surcharge:      surcharge,
+			Roaming:        isYes(optionalField(row.record, roamingIndex)),
+			RoamingCountry: optionalField(row.record, roamingCountryIndex),
+			Direction:      parseDirection(optionalField(row.record, directionIndex)),
+			Date:           date,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return m, warnings, err
+	}
 
-		m[phone]++
+	if len(m) == 0 {
+		return m, append(warnings, noRowsWarning("messages")), nil
 	}
 
-	return m, nil
+	return m, warnings, nil
+}
+
+// MegabyteRecord is a single row of a megabytes csv file. Type is the network type the data
+// was used on, like "4G LTE" or "3G", or empty if the file doesn't have a "Type" column.
+// Surcharge is any extra cost Ting charged for the data, which is paid by the device that used it.
+// Date is the day the data was used, or the zero time if the file doesn't say.
+type MegabyteRecord struct {
+	DeviceID  string
+	Kilobytes int
+	Type      string
+	Surcharge decimal.Decimal
+	Date      time.Time
 }
 
-// ParseMegabytes accepts an io.Reader from a megabytes csv file, and returns a map containing
-// usage data, or an error. The map's keys are `deviceID`s and the value is how much data
-// that device used in the billable month.
-func ParseMegabytes(megReader io.Reader) (map[string]int, error) {
-	m := make(map[string]int)
+// ParseMegabytes accepts an io.Reader from a megabytes csv file, and returns a MegabyteRecord
+// for each row, any warnings, or an error. A bad row is a *ParseError, see ParseOptions.
+func ParseMegabytes(megReader io.Reader, opts ParseOptions) ([]MegabyteRecord, []tingbill.Warning, error) {
+	var m []MegabyteRecord
 	r := csv.NewReader(megReader)
+	file := opts.file("megabytes")
 
 	// Get index of important fields
 	header, err := r.Read()
 
 	if err == io.EOF {
-		fmt.Println("megabytes.csv is empty!")
-		return m, err
+		return m, []tingbill.Warning{emptyFileWarning("megabytes")}, nil
 	}
 
 	if err != nil {
-		fmt.Println("Error parsing megabytes.csv")
-		return m, err
+		return m, nil, fmt.Errorf("parsing %s: %w", file, err)
 	}
 
 	phoneIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Device" })
 
 	if phoneIndex < 0 {
-		return m, errors.New(`missing "Device" header in megabytes csv file`)
+		return m, nil, fmt.Errorf(`missing "Device" header in %s`, file)
 	}
 
 	kbIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Kilobytes" })
 
 	if kbIndex < 0 {
-		return m, errors.New(`missing "Kilobytes" header in megabytes csv file`)
+		return m, nil, fmt.Errorf(`missing "Kilobytes" header in %s`, file)
 	}
 
-	for {
-		record, err := r.Read()
+	// Older files don't have a network type
+	typeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Type" })
+	surchargeIndex := sliceIndex(len(header), func(i int) bool { return header[i] == surchargeHeader })
+	dateIndex := sliceIndex(len(header), func(i int) bool { return header[i] == "Date" })
 
+	warnings, err := readRows(r, file, opts.Lenient, header, maxIndex(phoneIndex, kbIndex)+1, func(row csvRow) error {
+		id, err := row.phone(phoneIndex)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return m, err
+			return err
+		}
+
+		kb, err := row.int(kbIndex)
+		if err != nil {
+			return err
+		}
+
+		surcharge, err := row.surcharge(surchargeIndex)
+		if err != nil {
+			return err
 		}
 
-		kb, err := strconv.Atoi(record[kbIndex])
+		date, err := parseDateTime(row.record, dateIndex, -1)
 		if err != nil {
-			return m, err
+			return err
 		}
 
-		phone := record[phoneIndex]
+		m = append(m, MegabyteRecord{
+			DeviceID:  id,
+			Kilobytes: kb,
+			Type:      optionalField(row.record, typeIndex),
+			Surcharge: surcharge,
+			Date:      date,
+		})
 
-		m[phone] += kb
+		return nil
+	})
+	if err != nil {
+		return m, warnings, err
+	}
+
+	if len(m) == 0 {
+		return m, append(warnings, noRowsWarning("megabytes")), nil
 	}
 
-	return m, nil
+	return m, warnings, nil
 }
 
-// CalculateSplit accepts 3 map[string]int, one tingbill.Bill, and returns a tingbill.BillSplit
-// and an error.
-// The maps are for usage results from ParseMinutes, ParseMessages
-func CalculateSplit(min map[string]int, msg map[string]int, meg map[string]int, bil tingbill.Bill) (tingbill.BillSplit, error) {
+// maxIndex returns the largest of the column indexes.
+func maxIndex(indexes ...int) int {
+	max := -1
+	for _, i := range indexes {
+		if i > max {
+			max = i
+		}
+	}
+
+	return max
+}
+
+// optionalField returns the value in column index of a csv record, or an empty string if the
+// file doesn't have that column.
+func optionalField(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+
+	return record[index]
+}
+
+// isYes returns true for the values the usage csv files use for yes, like "yes" or "true".
+func isYes(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "yes", "y", "true":
+		return true
+	}
+
+	return false
+}
+
+// Usage holds every row parsed from the usage csv files for a billing period, by ParseMinutes,
+// ParseMessages and ParseMegabytes.
+type Usage struct {
+	Minutes   []MinuteRecord
+	Messages  []MessageRecord
+	Megabytes []MegabyteRecord
+}
+
+// CalculateSplit accepts the Usage for a billing period, one tingbill.Bill, and returns a
+// tingbill.BillSplit and an error.
+// Every cost in the resulting tingbill.BillSplit is rounded to the cent, and each category
+// is guaranteed to sum exactly to the respective cost on the Bill. If that can't be done,
+// an error is returned.
+func CalculateSplit(u Usage, bil tingbill.Bill) (tingbill.BillSplit, error) {
+	if err := checkActivePeriod(bil); err != nil {
+		return tingbill.BillSplit{}, err
+	}
+
+	// Rows from outside the billing period, like last month's, don't count
+	u, periodWarnings := periodUsage(u, bil)
+
+	// Usage for devices which aren't on the Bill is left out, or the devices are added, so
+	// every bit of usage is assigned to a device on the Bill
+	u, added, unknownWarnings, err := unknownDevices(u, bil)
+	if err != nil {
+		return tingbill.BillSplit{}, err
+	}
+	if len(added) > 0 {
+		bil.Devices = append(append([]tingbill.Device{}, bil.Devices...), added...)
+	}
+
+	// Minutes and messages only count in the directions the Bill's counting policies say
+	min, minOut, minIn := minuteUsage(u.Minutes, bil.Counting.Minutes)
+	msg, msgOut, msgIn := messageUsage(u.Messages, bil.Counting.Messages)
+
+	// Data is split by its weighted usage, so network types can count for more or less
+	meg, megByType, megWeighted := networkUsage(u.Megabytes, bil)
+
 	bs := tingbill.BillSplit{
-		MinuteCosts:     make(map[string]decimal.Decimal),
-		MinuteQty:       make(map[string]int),
-		MinutePercent:   make(map[string]decimal.Decimal),
-		MessageCosts:    make(map[string]decimal.Decimal),
-		MessageQty:      make(map[string]int),
-		MessagePercent:  make(map[string]decimal.Decimal),
-		MegabyteCosts:   make(map[string]decimal.Decimal),
-		MegabyteQty:     make(map[string]int),
-		MegabytePercent: make(map[string]decimal.Decimal),
-		SharedCosts:     make(map[string]decimal.Decimal),
-	}
-	var usedMin, usedMsg, usedMeg int
+		MinuteCosts:         make(map[string]decimal.Decimal),
+		MinuteQty:           make(map[string]decimal.Decimal),
+		MinutePercent:       make(map[string]decimal.Decimal),
+		MessageCosts:        make(map[string]decimal.Decimal),
+		MessageQty:          make(map[string]decimal.Decimal),
+		MessagePercent:      make(map[string]decimal.Decimal),
+		MegabyteCosts:       make(map[string]decimal.Decimal),
+		MegabyteQty:         make(map[string]int),
+		MegabytePercent:     make(map[string]decimal.Decimal),
+		MegabyteTypeQty:     make(map[string]map[string]int),
+		MegabyteWeightedQty: make(map[string]int),
+		SharedCosts:         make(map[string]decimal.Decimal),
+		SurchargeCosts:      make(map[string]decimal.Decimal),
+		MinuteOutQty:        minOut,
+		MinuteInQty:         minIn,
+		MessageOutQty:       msgOut,
+		MessageInQty:        msgIn,
+		Audit:               make(map[string][]tingbill.AuditStep),
+		AddedDevices:        added,
+	}
+	bs.Warnings = append(append(periodWarnings, unknownWarnings...), usageWarnings(min, msg, meg, bil)...)
+
+	var usedMeg int
+	usedMin := decimal.Zero
+	usedMsg := decimal.Zero
 	DecimalPrecision := int32(6)
 
-	bilMinutes := decimal.NewFromFloat(bil.Minutes + bil.ExtraMinutes)
-	bilMessages := decimal.NewFromFloat(bil.Messages + bil.ExtraMessages)
-	bilMegabytes := decimal.NewFromFloat(bil.Megabytes + bil.ExtraMegabytes)
-	delta := decimal.NewFromFloat(bil.DevicesCost + bil.Fees).Round(DecimalPrecision)
-	deviceQty := decimal.New(int64(len(bil.Devices)), 0)
+	bilMinutes := bil.Minutes.Add(bil.ExtraMinutes)
+	bilMessages := bil.Messages.Add(bil.ExtraMessages)
+	bilMegabytes := bil.Megabytes.Add(bil.ExtraMegabytes)
 
 	// Calculate usage totals
 	for _, v := range min {
-		usedMin += v
+		usedMin = usedMin.Add(v)
 	}
 
 	for _, v := range msg {
-		usedMsg += v
+		usedMsg = usedMsg.Add(v)
 	}
 
-	for _, v := range meg {
+	for _, v := range megWeighted {
 		usedMeg += v
 	}
 
-	totalMin := decimal.New(int64(usedMin), DecimalPrecision)
-	totalMsg := decimal.New(int64(usedMsg), DecimalPrecision)
 	totalMeg := decimal.New(int64(usedMeg), DecimalPrecision)
 
 	deviceIds := bil.DeviceIds()
 
 	for _, id := range deviceIds {
-		subMin := decimal.New(int64(min[id]), DecimalPrecision)
-		bs.MinutePercent[id] = subMin.Div(totalMin)
-		bs.MinuteCosts[id] = bs.MinutePercent[id].Mul(bilMinutes)
-		// It's possible for a device to still be on the Bill, but not show any usage data
-		if value, exists := min[id]; exists {
-			bs.MinuteQty[id] = value
-		} else {
-			bs.MinuteQty[id] = 0
+		// It's possible for a device to still be on the Bill, but not show any usage data,
+		// in which case the map lookups below are simply 0.
+		bs.MinuteQty[id] = min[id]
+		bs.MessageQty[id] = msg[id]
+		bs.MegabyteQty[id] = meg[id]
+		bs.MegabyteTypeQty[id] = megByType[id]
+		bs.MegabyteWeightedQty[id] = megWeighted[id]
+
+		// Categories nobody used have a percentage of 0 for every device
+		bs.MinutePercent[id] = decimal.Zero
+		bs.MessagePercent[id] = decimal.Zero
+		bs.MegabytePercent[id] = decimal.Zero
+
+		if usedMin.IsPositive() {
+			bs.MinutePercent[id] = min[id].Div(usedMin)
+		}
+
+		if usedMsg.IsPositive() {
+			bs.MessagePercent[id] = msg[id].DivRound(usedMsg, DecimalPrecision)
 		}
 
-		subMsg := decimal.New(int64(msg[id]), DecimalPrecision)
-		bs.MessagePercent[id] = subMsg.DivRound(totalMsg, DecimalPrecision)
-		bs.MessageCosts[id] = bs.MessagePercent[id].Mul(bilMessages)
-		// It's possible for a device to still be on the Bill, but not show any usage data
-		if value, exists := msg[id]; exists {
-			bs.MessageQty[id] = value
-		} else {
-			bs.MessageQty[id] = 0
+		if usedMeg > 0 {
+			subMeg := decimal.New(int64(megWeighted[id]), DecimalPrecision)
+			bs.MegabytePercent[id] = subMeg.DivRound(totalMeg, DecimalPrecision)
+		}
+	}
+
+	// Shared costs are prorated for devices which weren't active for the whole billing period
+	bs.Proration = prorationFactors(bil)
+
+	// Usage categories nobody used are split by the zero usage policy instead. With the
+	// "shared" policy, they're split like devicesCost and added to the shared costs.
+	var movedToShared []allocation
+
+	splitUsage := func(item string, amount decimal.Decimal, p tingbill.SplitPolicy, usage map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+		strategy := strategyName(p, StrategyProportional)
+
+		if !needsZeroUsage(amount, deviceIds, strategy, p, usage) {
+			a, err := splitCategory(amount, p, StrategyProportional, usage, bil)
+			if err != nil {
+				return nil, err
+			}
+
+			recordSplit(&bs, item, strategy, usage, a)
+			return a.Shares, nil
 		}
 
-		subMeg := decimal.New(int64(meg[id]), DecimalPrecision)
-		bs.MegabytePercent[id] = subMeg.DivRound(totalMeg, DecimalPrecision)
-		bs.MegabyteCosts[id] = bs.MegabytePercent[id].Mul(bilMegabytes)
-		// It's possible for a device to still be on the Bill, but not show any usage data
-		if value, exists := meg[id]; exists {
-			bs.MegabyteQty[id] = value
-		} else {
-			bs.MegabyteQty[id] = 0
+		policy := zeroUsagePolicy(bil)
+		bs.ZeroUsage = append(bs.ZeroUsage, tingbill.ZeroUsageSplit{Item: item, Policy: policy, Amount: amount})
+		bs.Warnings = append(bs.Warnings, zeroUsageWarning(item, amount, policy))
+
+		if policy == ZeroUsageShared {
+			a, err := splitProrated(amount, bil.Split.Devices, bs.Proration, bil)
+			if err != nil {
+				return nil, err
+			}
+
+			recordSplit(&bs, item+" (shared)", strategyName(bil.Split.Devices, StrategyEven), nil, a)
+			movedToShared = append(movedToShared, a)
+
+			shares := make(map[string]decimal.Decimal)
+			for _, id := range deviceIds {
+				shares[id] = decimal.Zero
+			}
+			return shares, nil
 		}
 
-		bs.SharedCosts[id] = delta.DivRound(deviceQty, DecimalPrecision)
+		a, err := splitZeroUsage(amount, deviceIds, policy, bil)
+		if err != nil {
+			return nil, err
+		}
+
+		recordSplit(&bs, item, policy, nil, a)
+		return a.Shares, nil
+	}
+
+	// Roaming and international usage is only paid for by the devices which used it. With a
+	// rate, it's taken out of the minutes or messages cost first.
+	intl := bil.International
+	bs.InternationalMinuteQty, bs.InternationalMessageQty, bs.InternationalCountries = internationalUsage(u, bil)
+
+	bs.InternationalMinuteCosts, bilMinutes, err = splitInternational("International minutes", intl.MinuteRate, intl.Minutes, bs.InternationalMinuteQty, bilMinutes, &bs, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting international minutes: %w", err)
+	}
+
+	bs.InternationalMessageCosts, bilMessages, err = splitInternational("International messages", intl.MessageRate, intl.Messages, bs.InternationalMessageQty, bilMessages, &bs, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting international messages: %w", err)
+	}
+
+	// Usage charged at a rate doesn't count again for the rest of the cost
+	unrated := unratedUsage(u, bil)
+	unratedMin, _, _ := minuteUsage(unrated.Minutes, bil.Counting.Minutes)
+	unratedMsg, _, _ := messageUsage(unrated.Messages, bil.Counting.Messages)
+
+	bs.MinuteCosts, err = splitUsage("Minutes", bilMinutes, bil.Split.Minutes, unratedMin)
+	if err != nil {
+		return bs, fmt.Errorf("splitting minutes: %w", err)
+	}
+
+	bs.MessageCosts, err = splitUsage("Messages", bilMessages, bil.Split.Messages, unratedMsg)
+	if err != nil {
+		return bs, fmt.Errorf("splitting messages: %w", err)
+	}
+
+	for _, id := range deviceIds {
+		bs.MinuteCosts[id] = bs.MinuteCosts[id].Add(bs.InternationalMinuteCosts[id])
+		bs.MessageCosts[id] = bs.MessageCosts[id].Add(bs.InternationalMessageCosts[id])
+	}
+
+	bs.MegabyteCosts, err = splitUsage("Data", bilMegabytes, bil.Split.Megabytes, decimalUsage(bs.MegabyteWeightedQty))
+	if err != nil {
+		return bs, fmt.Errorf("splitting megabytes: %w", err)
 	}
 
-	minSubSum := decimal.New(0, DecimalPrecision)
-	for _, sub := range bs.MinuteCosts {
-		minSubSum = minSubSum.Add(sub)
+	// Surcharges are paid by the devices which incurred them, so they're taken out of the shared costs
+	devicesCost, fees, err := splitSurcharges(u, &bs, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting surcharges: %w", err)
 	}
 
-	minSubExtra := bilMinutes.Sub(minSubSum)
-	if minSubExtra.GreaterThan(decimal.New(0, DecimalPrecision)) {
-		fmt.Printf("Remainder minutes cost of $%s to deviceId %s\n", minSubExtra.String(), bil.ShortStrawID)
-		bs.MinuteCosts[bil.ShortStrawID].Add(minSubExtra)
-	} else {
-		fmt.Println("There was no remainder cost when splitting minutes.")
+	devSplit, err := splitProrated(devicesCost, bil.Split.Devices, bs.Proration, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting devices cost: %w", err)
 	}
+	recordSplit(&bs, "Devices", strategyName(bil.Split.Devices, StrategyEven), nil, devSplit)
 
-	msgSubSum := decimal.New(0, DecimalPrecision)
-	for _, sub := range bs.MessageCosts {
-		msgSubSum = msgSubSum.Add(sub)
+	feeSplit, err := splitProrated(fees, bil.Split.Fees, bs.Proration, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting fees: %w", err)
 	}
+	recordSplit(&bs, "Tax & Reg", strategyName(bil.Split.Fees, StrategyEven), nil, feeSplit)
+
+	for _, id := range deviceIds {
+		bs.SharedCosts[id] = devSplit.Shares[id].Add(feeSplit.Shares[id])
 
-	msgSubExtra := bilMessages.Sub(msgSubSum)
-	if msgSubExtra.GreaterThan(decimal.New(0, DecimalPrecision)) {
-		fmt.Printf("Remainder messages cost of $%s to deviceId %s\n", msgSubExtra.String(), bil.ShortStrawID)
-		bs.MessageCosts[bil.ShortStrawID].Add(msgSubExtra)
-	} else {
-		fmt.Println("There was no remainder cost when splitting messages.")
+		for _, a := range movedToShared {
+			bs.SharedCosts[id] = bs.SharedCosts[id].Add(a.Shares[id])
+		}
 	}
 
-	megSubSum := decimal.New(0, DecimalPrecision)
-	for _, sub := range bs.MegabyteCosts {
-		megSubSum = megSubSum.Add(sub)
+	for _, c := range bil.Charges {
+		cs, err := splitCharge("Charge", c, c.Amount, &bs, bil)
+		if err != nil {
+			return bs, fmt.Errorf("splitting charge %q: %w", c.Name, err)
+		}
+
+		bs.Charges = append(bs.Charges, cs)
 	}
 
-	megSubExtra := bilMessages.Sub(megSubSum)
-	if megSubExtra.GreaterThan(decimal.New(0, DecimalPrecision)) {
-		fmt.Printf("Remainder megabytes cost of $%s to deviceId %s\n", megSubExtra.String(), bil.ShortStrawID)
-		bs.MegabyteCosts[bil.ShortStrawID].Add(megSubExtra)
-	} else {
-		fmt.Println("There was no remainder cost when splitting megabytes.")
+	// Credits are entered as positive amounts, and reduce what devices owe
+	for _, c := range bil.Credits {
+		cs, err := splitCharge("Credit", c, c.Amount.Neg(), &bs, bil)
+		if err != nil {
+			return bs, fmt.Errorf("splitting credit %q: %w", c.Name, err)
+		}
+
+		bs.Credits = append(bs.Credits, cs)
 	}
 
-	deltaSubSum := decimal.New(0, DecimalPrecision)
-	for _, sub := range bs.SharedCosts {
-		deltaSubSum = deltaSubSum.Add(sub)
+	if err := applyLimits(&bs, bil, devSplit); err != nil {
+		return bs, err
 	}
 
-	deltaSubExtra := delta.Sub(deltaSubSum)
-	if deltaSubExtra.GreaterThan(decimal.New(0, DecimalPrecision)) {
-		fmt.Printf("Remainder delta cost of $%s added to deviceId %s\n", deltaSubExtra.String(), bil.ShortStrawID)
-		bs.SharedCosts[bil.ShortStrawID] = bs.SharedCosts[bil.ShortStrawID].Add(deltaSubExtra)
-	} else {
-		fmt.Println("There was no remainder cost when splitting delta.")
+	bs.OwnerCosts = ownerRollup(bs, bil)
+
+	bs.PayerCosts, err = payerSplit(bs, bil)
+	if err != nil {
+		return bs, fmt.Errorf("splitting between payers: %w", err)
 	}
 
 	return bs, nil
 }
+
+// payerSplit divides what each device owes between its payers, by their percentage shares.
+// The result is keyed by payer, then deviceId.
+func payerSplit(bs tingbill.BillSplit, bil tingbill.Bill) (map[string]map[string]decimal.Decimal, error) {
+	payers := make(map[string]map[string]decimal.Decimal)
+
+	for _, d := range bil.Devices {
+		shares := d.PayerShares()
+		names := shares.Keys()
+
+		// Leftover cents go to the payers whose shares lost the most when rounded down, with ties
+		// going to the first alphabetically
+		costs, err := allocateCents(bs.DeviceTotal(d.DeviceID), names, shares, RemainderLargest, "")
+		if err != nil {
+			return payers, fmt.Errorf("deviceId %s: %w", d.DeviceID, err)
+		}
+
+		for _, p := range names {
+			if payers[p] == nil {
+				payers[p] = make(map[string]decimal.Decimal)
+			}
+			payers[p][d.DeviceID] = costs[p]
+		}
+	}
+
+	return payers, nil
+}
+
+// ownerRollup sums the costs of every device by its owner.
+func ownerRollup(bs tingbill.BillSplit, bil tingbill.Bill) map[string]tingbill.OwnerSplit {
+	owners := make(map[string]tingbill.OwnerSplit)
+
+	for _, owner := range bil.Owners() {
+		o := tingbill.OwnerSplit{
+			DeviceIDs: bil.DeviceIdsByOwner(owner),
+		}
+
+		for _, id := range o.DeviceIDs {
+			o.MinuteCosts = o.MinuteCosts.Add(bs.MinuteCosts[id])
+			o.MessageCosts = o.MessageCosts.Add(bs.MessageCosts[id])
+			o.MegabyteCosts = o.MegabyteCosts.Add(bs.MegabyteCosts[id])
+			o.SharedCosts = o.SharedCosts.Add(bs.SharedCosts[id])
+			o.SurchargeCosts = o.SurchargeCosts.Add(bs.SurchargeCosts[id])
+			o.ChargeCosts = o.ChargeCosts.Add(bs.ChargeTotal(id))
+			o.DeviceCharges = o.DeviceCharges.Add(bs.DeviceChargeTotal(id))
+			o.CreditCosts = o.CreditCosts.Add(bs.CreditTotal(id))
+			o.LimitCosts = o.LimitCosts.Add(bs.LimitCosts[id])
+			o.Total = o.Total.Add(bs.DeviceTotal(id))
+		}
+
+		owners[owner] = o
+	}
+
+	return owners
+}
+
+// splitCharge splits amount for a Charge or credit from the Bill. If the Charge has a DeviceID,
+// the whole amount goes to that device. If it has an Owner, only that owner's devices take part
+// in the split. Otherwise it's split between every device. The resulting Costs only include
+// the devices which took part. The split is added to the audit trail of those devices,
+// labeled with kind.
+func splitCharge(kind string, c tingbill.Charge, amount decimal.Decimal, bs *tingbill.BillSplit, bil tingbill.Bill) (tingbill.ChargeSplit, error) {
+	cs := tingbill.ChargeSplit{
+		Name:     c.Name,
+		Category: c.Category,
+		DeviceID: c.DeviceID,
+		Owner:    c.Owner,
+		Amount:   amount,
+	}
+
+	if c.DeviceID != "" {
+		cs.Strategy = StrategyDevice
+
+		a, err := allocate(amount, []string{c.DeviceID}, map[string]decimal.Decimal{c.DeviceID: decimal.New(1, 0)}, RemainderLargest, c.DeviceID)
+		if err != nil {
+			return cs, err
+		}
+
+		cs.Costs = a.Shares
+		recordSplit(bs, fmt.Sprintf("%s %q", kind, c.Name), cs.Strategy, nil, a)
+		return cs, nil
+	}
+
+	ids := bil.DeviceIds()
+	if c.Owner != "" {
+		ids = bil.DeviceIdsByOwner(c.Owner)
+	}
+
+	usage, defaultStrategy := categoryUsage(c.Category, *bs)
+
+	cs.Strategy = strategyName(c.SplitPolicy, defaultStrategy)
+	item := fmt.Sprintf("%s %q", kind, c.Name)
+
+	// A charge can't be moved into shared costs, so the "shared" zero usage policy splits it evenly
+	if needsZeroUsage(amount, ids, cs.Strategy, c.SplitPolicy, usage) {
+		policy := zeroUsagePolicy(bil)
+		if policy == ZeroUsageShared {
+			policy = ZeroUsageEven
+		}
+
+		bs.ZeroUsage = append(bs.ZeroUsage, tingbill.ZeroUsageSplit{Item: item, Policy: policy, Amount: amount})
+		bs.Warnings = append(bs.Warnings, zeroUsageWarning(item, amount, policy))
+
+		a, err := splitZeroUsage(amount, ids, policy, bil)
+		if err != nil {
+			return cs, err
+		}
+
+		cs.Strategy = policy
+		cs.Costs = a.Shares
+		recordSplit(bs, item, cs.Strategy, nil, a)
+
+		return cs, nil
+	}
+
+	a, err := splitBetween(amount, ids, c.SplitPolicy, defaultStrategy, usage, bil)
+	if err != nil {
+		return cs, err
+	}
+
+	cs.Costs = a.Shares
+	recordSplit(bs, item, cs.Strategy, usage, a)
+
+	return cs, nil
+}
+
+// categoryUsage returns the usage data and default strategy name for a Charge category.
+// Shared charges have no usage data, and are split evenly by default.
+func categoryUsage(category string, bs tingbill.BillSplit) (map[string]decimal.Decimal, string) {
+	switch category {
+	case CategoryMinutes:
+		return bs.MinuteQty, StrategyProportional
+	case CategoryMessages:
+		return bs.MessageQty, StrategyProportional
+	case CategoryMegabytes:
+		return decimalUsage(bs.MegabyteWeightedQty), StrategyProportional
+	default:
+		return nil, StrategyEven
+	}
+}
+
+// splitCategory divides amount between the Bill's devices, using the AllocationStrategy
+// selected by p, or defaultStrategy if p doesn't name one.
+func splitCategory(amount decimal.Decimal, p tingbill.SplitPolicy, defaultStrategy string, usage map[string]decimal.Decimal, bil tingbill.Bill) (allocation, error) {
+	return splitBetween(amount, bil.DeviceIds(), p, defaultStrategy, usage, bil)
+}
+
+// splitProrated divides amount between the Bill's devices, using the AllocationStrategy selected
+// by p, or an even split if p doesn't name one, scaled by each device's proration factor.
+func splitProrated(amount decimal.Decimal, p tingbill.SplitPolicy, factors map[string]decimal.Decimal, bil tingbill.Bill) (allocation, error) {
+	s, err := NewStrategy(p, StrategyEven)
+	if err != nil {
+		return allocation{}, err
+	}
+
+	return splitWith(amount, bil.DeviceIds(), ProratedStrategy{Strategy: s, Factors: factors}, nil, bil)
+}
+
+// splitBetween divides amount between ids, which may be a subset of the Bill's devices.
+func splitBetween(amount decimal.Decimal, ids []string, p tingbill.SplitPolicy, defaultStrategy string, usage map[string]decimal.Decimal, bil tingbill.Bill) (allocation, error) {
+	s, err := NewStrategy(p, defaultStrategy)
+	if err != nil {
+		return allocation{}, err
+	}
+
+	return splitWith(amount, ids, s, usage, bil)
+}
+
+// splitWith divides amount between ids using the AllocationStrategy s, and turns the
+// resulting weights into cent-exact shares.
+func splitWith(amount decimal.Decimal, ids []string, s AllocationStrategy, usage map[string]decimal.Decimal, bil tingbill.Bill) (allocation, error) {
+	shortStrawID := bil.ShortStrawID
+	if sliceIndex(len(ids), func(i int) bool { return ids[i] == shortStrawID }) < 0 {
+		shortStrawID = ids[0]
+	}
+
+	weights, err := s.Weights(ids, usage)
+	if err != nil {
+		return allocation{}, err
+	}
+
+	return allocate(amount, ids, weights, bil.RemainderPolicy, shortStrawID)
+}
+
+// strategyName returns the name of the strategy p selects, or defaultStrategy if it doesn't name one.
+func strategyName(p tingbill.SplitPolicy, defaultStrategy string) string {
+	if p.Strategy == "" {
+		return defaultStrategy
+	}
+
+	return p.Strategy
+}
+
+// recordSplit adds an AuditStep to the trail of every device which took part in allocation a,
+// along with a warning if leftover cents had to be handed out. usage is nil for costs which
+// aren't based on usage.
+func recordSplit(bs *tingbill.BillSplit, item string, strategy string, usage map[string]decimal.Decimal, a allocation) {
+	if w, ok := remainderWarning(item, a); ok {
+		bs.Warnings = append(bs.Warnings, w)
+	}
+
+	totalUsage := decimal.Zero
+	for _, id := range a.IDs {
+		totalUsage = totalUsage.Add(usage[id])
+	}
+
+	for _, id := range a.IDs {
+		share := a.Shares[id]
+		step := tingbill.AuditStep{
+			Item:        item,
+			Strategy:    strategy,
+			Amount:      a.Amount,
+			UsageBased:  usage != nil,
+			Weight:      a.Weights[id],
+			TotalWeight: a.TotalWeight,
+			Exact:       a.Exact[id],
+			Rounded:     a.Rounded[id],
+			Adjustment:  share.Sub(a.Rounded[id]),
+			Share:       share,
+		}
+
+		if usage != nil {
+			step.Usage = usage[id]
+			step.TotalUsage = totalUsage
+		}
+
+		if !a.TotalWeight.IsZero() {
+			step.Percent = a.Weights[id].Mul(decimal.New(100, 0)).DivRound(a.TotalWeight, 16)
+		}
+
+		bs.Audit[id] = append(bs.Audit[id], step)
+	}
+}
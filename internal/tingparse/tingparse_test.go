@@ -1,10 +1,16 @@
 package tingparse
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hitjim/ting-bill-split/internal/tingbill"
 	"github.com/shopspring/decimal"
 )
@@ -12,22 +18,23 @@ import (
 func TestParseMinutes(t *testing.T) {
 	cases := []struct {
 		in   string
-		want map[string]int
+		want []MinuteRecord
 	}{
 		{
 			`Date,Time,Incoming/Outgoing,Phone,Nickname,Location,Country,Partner's Phone,Partner Nickname,Partner's Location,Partner's Country,Duration (min),Surcharges ($),Features
 "February 03, 2011",01:11,outgoing,1112223333,Phone 1,"SPRINGFIELD, MO",USA,7778889999,,USA,United States of America,1,0.0,""
 "February 14, 2011",01:22,outgoing,1112223333,Phone 1,"SPRINGFIELD, MO",USA,7778889999,,USA,United States of America,2,0.0,""
-"February 14, 2011",01:22,outgoing,1112224444,Phone 2,"DELANO, KS",USA,7778889999,,USA,United States of America,1,0.0,""`,
-			map[string]int{
-				"1112223333": 3,
-				"1112224444": 1,
+"February 14, 2011",01:22,outgoing,1112224444,Phone 2,"DELANO, KS",USA,7778889999,,USA,United States of America,1,0.25,""`,
+			[]MinuteRecord{
+				{"1112223333", 1, decimal.Zero, "USA", "United States of America", DirectionOutgoing, time.Date(2011, 2, 3, 1, 11, 0, 0, time.UTC)},
+				{"1112223333", 2, decimal.Zero, "USA", "United States of America", DirectionOutgoing, time.Date(2011, 2, 14, 1, 22, 0, 0, time.UTC)},
+				{"1112224444", 1, decimal.NewFromFloat(0.25), "USA", "United States of America", DirectionOutgoing, time.Date(2011, 2, 14, 1, 22, 0, 0, time.UTC)},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		got, err := ParseMinutes(strings.NewReader(c.in))
+		got, _, err := ParseMinutes(strings.NewReader(c.in), ParseOptions{})
 		if err != nil {
 			t.Errorf("ParseMinutes(%v) err, %v", c.in, err)
 		}
@@ -40,22 +47,23 @@ func TestParseMinutes(t *testing.T) {
 func TestParseMessages(t *testing.T) {
 	cases := []struct {
 		in   string
-		want map[string]int
+		want []MessageRecord
 	}{
 		{
 			`Date,Time,Phone,Nickname,Partner's Phone,Partner's Nickname,Sent/Received,Roaming,Roaming Country,Surcharges ($)
 "February 03, 2011",01:11,1112223333,Phone 1,7778889999,Phone 7,sent,no,"",0.0
 "February 03, 2011",01:12,1112223333,Phone 1,7778889999,Phone 7,received,no,"",0.0
-"February 03, 2011",01:12,1112224444,Phone 1,7778889999,Phone 7,received,no,"",0.0`,
-			map[string]int{
-				"1112223333": 2,
-				"1112224444": 1,
+"February 03, 2011",01:12,1112224444,Phone 1,7778889999,Phone 7,received,no,"",0.10`,
+			[]MessageRecord{
+				{"1112223333", decimal.Zero, false, "", DirectionOutgoing, time.Date(2011, 2, 3, 1, 11, 0, 0, time.UTC)},
+				{"1112223333", decimal.Zero, false, "", DirectionIncoming, time.Date(2011, 2, 3, 1, 12, 0, 0, time.UTC)},
+				{"1112224444", decimal.NewFromFloat(0.1), false, "", DirectionIncoming, time.Date(2011, 2, 3, 1, 12, 0, 0, time.UTC)},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		got, err := ParseMessages(strings.NewReader(c.in))
+		got, _, err := ParseMessages(strings.NewReader(c.in), ParseOptions{})
 		if err != nil {
 			t.Errorf("ParseMessages(%v) err, %v", c.in, err)
 		}
@@ -68,7 +76,7 @@ func TestParseMessages(t *testing.T) {
 func TestParseMegabytes(t *testing.T) {
 	cases := []struct {
 		in   string
-		want map[string]int
+		want []MegabyteRecord
 	}{
 		{
 			`Date,Device,Nickname,Location,Kilobytes,Surcharges ($),Type
@@ -76,15 +84,24 @@ func TestParseMegabytes(t *testing.T) {
 "February 03, 2011",1112223333,Phone 1,United States of America,2024,0.0,3G
 "February 04, 2011",1112223333,Phone 1,United States of America,1336,0.0,4G LTE
 "February 04, 2011",1112224444,Phone 2,United States of America,1532,0.0,4G LTE`,
-			map[string]int{
-				"1112223333": 4696,
-				"1112224444": 1532,
+			[]MegabyteRecord{
+				{"1112223333", 1336, "4G LTE", decimal.Zero, time.Date(2011, 2, 3, 0, 0, 0, 0, time.UTC)},
+				{"1112223333", 2024, "3G", decimal.Zero, time.Date(2011, 2, 3, 0, 0, 0, 0, time.UTC)},
+				{"1112223333", 1336, "4G LTE", decimal.Zero, time.Date(2011, 2, 4, 0, 0, 0, 0, time.UTC)},
+				{"1112224444", 1532, "4G LTE", decimal.Zero, time.Date(2011, 2, 4, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			`Device,Kilobytes
+1112223333,1336`,
+			[]MegabyteRecord{
+				{"1112223333", 1336, "", decimal.Zero, time.Time{}},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		got, err := ParseMegabytes(strings.NewReader(c.in))
+		got, _, err := ParseMegabytes(strings.NewReader(c.in), ParseOptions{})
 		if err != nil {
 			t.Errorf("ParseMegabytes(%v) err, %v", c.in, err)
 		}
@@ -125,14 +142,14 @@ deviceId = "1112220000"
 owner = "owner2"`,
 			tingbill.Bill{
 				Description:    "First test desc",
-				DevicesCost:    42.00,
-				Minutes:        35.00,
-				Messages:       8.00,
-				Megabytes:      20.00,
-				ExtraMinutes:   1.00,
-				ExtraMessages:  2.00,
-				ExtraMegabytes: 3.00,
-				Fees:           12.85,
+				DevicesCost:    decimal.NewFromFloat(42.00),
+				Minutes:        decimal.NewFromFloat(35.00),
+				Messages:       decimal.NewFromFloat(8.00),
+				Megabytes:      decimal.NewFromFloat(20.00),
+				ExtraMinutes:   decimal.NewFromFloat(1.00),
+				ExtraMessages:  decimal.NewFromFloat(2.00),
+				ExtraMegabytes: decimal.NewFromFloat(3.00),
+				Fees:           decimal.NewFromFloat(12.85),
 				Devices: []tingbill.Device{
 					tingbill.Device{
 						DeviceID: "1112223333",
@@ -148,7 +165,7 @@ owner = "owner2"`,
 					},
 				},
 				ShortStrawID: "1112223333",
-				Total:        118.84,
+				Total:        decimal.NewFromFloat(118.84),
 			},
 		},
 	}
@@ -164,6 +181,28 @@ owner = "owner2"`,
 	}
 }
 
+// testUsage turns usage maps, keyed by deviceId, into the Usage CalculateSplit expects.
+// There are no surcharges, and data has no network type.
+func testUsage(min map[string]int, msg map[string]int, meg map[string]int) Usage {
+	var u Usage
+
+	for _, id := range sortedKeys(min) {
+		u.Minutes = append(u.Minutes, MinuteRecord{DeviceID: id, Minutes: min[id]})
+	}
+
+	for _, id := range sortedKeys(msg) {
+		for i := 0; i < msg[id]; i++ {
+			u.Messages = append(u.Messages, MessageRecord{DeviceID: id})
+		}
+	}
+
+	for _, id := range sortedKeys(meg) {
+		u.Megabytes = append(u.Megabytes, MegabyteRecord{DeviceID: id, Kilobytes: meg[id]})
+	}
+
+	return u
+}
+
 func TestCalculateSplit(t *testing.T) {
 	DecimalPrecision := int32(6)
 	cases := []struct {
@@ -188,14 +227,14 @@ func TestCalculateSplit(t *testing.T) {
 			},
 			tingbill.Bill{
 				Description:    "TestParseMaps",
-				DevicesCost:    42.00,
-				Minutes:        35.00,
-				Messages:       8.00,
-				Megabytes:      20.00,
-				ExtraMinutes:   1.00,
-				ExtraMessages:  2.00,
-				ExtraMegabytes: 3.00,
-				Fees:           12.85,
+				DevicesCost:    decimal.NewFromFloat(42.00),
+				Minutes:        decimal.NewFromFloat(35.00),
+				Messages:       decimal.NewFromFloat(8.00),
+				Megabytes:      decimal.NewFromFloat(20.00),
+				ExtraMinutes:   decimal.NewFromFloat(1.00),
+				ExtraMessages:  decimal.NewFromFloat(2.00),
+				ExtraMegabytes: decimal.NewFromFloat(3.00),
+				Fees:           decimal.NewFromFloat(12.85),
 				Devices: []tingbill.Device{
 					tingbill.Device{
 						DeviceID: "1112223333",
@@ -211,7 +250,7 @@ func TestCalculateSplit(t *testing.T) {
 					},
 				},
 				ShortStrawID: "1112220000",
-				Total:        118.84,
+				Total:        decimal.NewFromFloat(118.84),
 			},
 			tingbill.BillSplit{
 				MinuteCosts: map[string]decimal.Decimal{
@@ -219,10 +258,10 @@ func TestCalculateSplit(t *testing.T) {
 					"1112223333": decimal.NewFromFloat(28.8).Round(DecimalPrecision),
 					"1112224444": decimal.NewFromFloat(7.2).Round(DecimalPrecision),
 				},
-				MinuteQty: map[string]int{
-					"1112220000": 0,
-					"1112223333": 4,
-					"1112224444": 1,
+				MinuteQty: map[string]decimal.Decimal{
+					"1112220000": decimal.Zero,
+					"1112223333": decimal.New(4, 0),
+					"1112224444": decimal.New(1, 0),
 				},
 				MinutePercent: map[string]decimal.Decimal{
 					"1112220000": decimal.NewFromFloat(0),
@@ -231,23 +270,23 @@ func TestCalculateSplit(t *testing.T) {
 				},
 				MessageCosts: map[string]decimal.Decimal{
 					"1112220000": decimal.NewFromFloat(0).Round(DecimalPrecision),
-					"1112223333": decimal.NewFromFloat(7.54014).Round(DecimalPrecision),
-					"1112224444": decimal.NewFromFloat(2.45986).Round(DecimalPrecision),
+					"1112223333": decimal.NewFromFloat(7.54).Round(DecimalPrecision),
+					"1112224444": decimal.NewFromFloat(2.46).Round(DecimalPrecision),
 				},
 				MessagePercent: map[string]decimal.Decimal{
 					"1112220000": decimal.NewFromFloat(0),
 					"1112223333": decimal.NewFromFloat(0.754014),
 					"1112224444": decimal.NewFromFloat(0.245986),
 				},
-				MessageQty: map[string]int{
-					"1112220000": 0,
-					"1112223333": 4696,
-					"1112224444": 1532,
+				MessageQty: map[string]decimal.Decimal{
+					"1112220000": decimal.Zero,
+					"1112223333": decimal.New(4696, 0),
+					"1112224444": decimal.New(1532, 0),
 				},
 				MegabyteCosts: map[string]decimal.Decimal{
 					"1112220000": decimal.NewFromFloat(0).Round(DecimalPrecision),
-					"1112223333": decimal.NewFromFloat(16.729372).Round(DecimalPrecision),
-					"1112224444": decimal.NewFromFloat(6.270628).Round(DecimalPrecision),
+					"1112223333": decimal.NewFromFloat(16.73).Round(DecimalPrecision),
+					"1112224444": decimal.NewFromFloat(6.27).Round(DecimalPrecision),
 				},
 				MegabytePercent: map[string]decimal.Decimal{
 					"1112220000": decimal.NewFromFloat(0),
@@ -260,21 +299,2220 @@ func TestCalculateSplit(t *testing.T) {
 					"1112224444": 2999,
 				},
 				SharedCosts: map[string]decimal.Decimal{
-					"1112223333": decimal.NewFromFloat(18.283333),
-					"1112224444": decimal.NewFromFloat(18.283333),
-					"1112220000": decimal.NewFromFloat(18.283334),
+					"1112223333": decimal.NewFromFloat(18.28),
+					"1112224444": decimal.NewFromFloat(18.28),
+					"1112220000": decimal.NewFromFloat(18.29),
+				},
+				SurchargeCosts: map[string]decimal.Decimal{
+					"1112223333": decimal.Zero,
+					"1112224444": decimal.Zero,
+					"1112220000": decimal.Zero,
+				},
+				Proration: map[string]decimal.Decimal{
+					"1112223333": decimal.NewFromFloat(1),
+					"1112224444": decimal.NewFromFloat(1),
+					"1112220000": decimal.NewFromFloat(1),
+				},
+				OwnerCosts: map[string]tingbill.OwnerSplit{
+					"owner1": tingbill.OwnerSplit{
+						DeviceIDs:     []string{"1112223333", "1112220000"},
+						MinuteCosts:   decimal.NewFromFloat(28.8),
+						MessageCosts:  decimal.NewFromFloat(7.54),
+						MegabyteCosts: decimal.NewFromFloat(16.73),
+						SharedCosts:   decimal.NewFromFloat(36.57),
+						Total:         decimal.NewFromFloat(89.64),
+					},
+					"owner2": tingbill.OwnerSplit{
+						DeviceIDs:     []string{"1112224444"},
+						MinuteCosts:   decimal.NewFromFloat(7.2),
+						MessageCosts:  decimal.NewFromFloat(2.46),
+						MegabyteCosts: decimal.NewFromFloat(6.27),
+						SharedCosts:   decimal.NewFromFloat(18.28),
+						Total:         decimal.NewFromFloat(34.21),
+					},
+				},
+				PayerCosts: map[string]map[string]decimal.Decimal{
+					"owner1": map[string]decimal.Decimal{
+						"1112223333": decimal.NewFromFloat(71.35),
+						"1112220000": decimal.NewFromFloat(18.29),
+					},
+					"owner2": map[string]decimal.Decimal{
+						"1112224444": decimal.NewFromFloat(34.21),
+					},
 				},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		got, err := CalculateSplit(c.min, c.msg, c.meg, c.bil)
+		got, err := CalculateSplit(testUsage(c.min, c.msg, c.meg), c.bil)
 		if err != nil {
 			t.Errorf("ParseMaps(%v, %v, %v, %v) err, %v", c.min, c.msg, c.meg, c.bil, err)
 		}
-		if !cmp.Equal(got, c.want) {
+		// The audit trail and warnings are covered by TestCalculateSplitAudit and TestCalculateSplitWarnings
+		if !cmp.Equal(got, c.want, cmpopts.IgnoreFields(tingbill.BillSplit{}, "Audit", "Warnings", "MegabyteTypeQty", "MegabyteWeightedQty",
+			"InternationalMinuteQty", "InternationalMessageQty", "InternationalMinuteCosts", "InternationalMessageCosts", "InternationalCountries",
+			"MinuteOutQty", "MinuteInQty", "MessageOutQty", "MessageInQty")) {
 			t.Errorf("ParseMaps(%v, %v, %v, %v) == %v, want %v", c.min, c.msg, c.meg, c.bil, got, c.want)
 		}
 	}
 }
+
+func TestAllocateCents(t *testing.T) {
+	ids := []string{"1112223333", "1112224444", "1112220000"}
+	cases := []struct {
+		amount  decimal.Decimal
+		weights map[string]decimal.Decimal
+		policy  string
+		want    map[string]decimal.Decimal
+	}{
+		{
+			decimal.NewFromFloat(10.00),
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(1),
+				"1112224444": decimal.NewFromFloat(1),
+				"1112220000": decimal.NewFromFloat(1),
+			},
+			RemainderLargest,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(3.33),
+				"1112224444": decimal.NewFromFloat(3.33),
+				"1112220000": decimal.NewFromFloat(3.34),
+			},
+		},
+		{
+			decimal.NewFromFloat(1.00),
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(1),
+				"1112224444": decimal.NewFromFloat(1),
+				"1112220000": decimal.NewFromFloat(4),
+			},
+			RemainderLargest,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(0.17),
+				"1112224444": decimal.NewFromFloat(0.16),
+				"1112220000": decimal.NewFromFloat(0.67),
+			},
+		},
+		{
+			decimal.NewFromFloat(0.05),
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(1),
+				"1112224444": decimal.NewFromFloat(1),
+				"1112220000": decimal.NewFromFloat(1),
+			},
+			RemainderShortStraw,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(0.01),
+				"1112224444": decimal.NewFromFloat(0.01),
+				"1112220000": decimal.NewFromFloat(0.03),
+			},
+		},
+		{
+			decimal.NewFromFloat(-10.00),
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(1),
+				"1112224444": decimal.NewFromFloat(1),
+				"1112220000": decimal.NewFromFloat(1),
+			},
+			RemainderLargest,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(-3.33),
+				"1112224444": decimal.NewFromFloat(-3.33),
+				"1112220000": decimal.NewFromFloat(-3.34),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := allocateCents(c.amount, ids, c.weights, c.policy, "1112220000")
+		if err != nil {
+			t.Errorf("allocateCents(%v, %v, %v) err, %v", c.amount, c.weights, c.policy, err)
+		}
+		if !cmp.Equal(got, c.want) {
+			t.Errorf("allocateCents(%v, %v, %v) == %v, want %v", c.amount, c.weights, c.policy, got, c.want)
+		}
+	}
+}
+
+func TestCalculateSplitStrategies(t *testing.T) {
+	bil := tingbill.Bill{
+		Description: "TestCalculateSplitStrategies",
+		DevicesCost: decimal.NewFromFloat(30.00),
+		Megabytes:   decimal.NewFromFloat(10.00),
+		Fees:        decimal.NewFromFloat(6.00),
+		Devices: []tingbill.Device{
+			tingbill.Device{
+				DeviceID: "1112223333",
+				Owner:    "owner1",
+			},
+			tingbill.Device{
+				DeviceID: "1112224444",
+				Owner:    "owner2",
+			},
+		},
+		ShortStrawID: "1112223333",
+		Total:        decimal.NewFromFloat(46.00),
+		Split: tingbill.SplitPolicies{
+			Megabytes: tingbill.SplitPolicy{
+				Strategy:    StrategyHybrid,
+				EvenPercent: decimal.NewFromFloat(40),
+			},
+			Devices: tingbill.SplitPolicy{
+				Strategy: StrategyWeighted,
+				Weights: tingbill.Weights{
+					"1112223333": decimal.NewFromFloat(2),
+					"1112224444": decimal.NewFromFloat(1),
+				},
+			},
+		},
+	}
+	min := map[string]int{
+		"1112223333": 10,
+	}
+	msg := map[string]int{
+		"1112224444": 10,
+	}
+	meg := map[string]int{
+		"1112223333": 3000,
+		"1112224444": 1000,
+	}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Split, err)
+	}
+
+	wantMeg := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(6.50),
+		"1112224444": decimal.NewFromFloat(3.50),
+	}
+	if !cmp.Equal(got.MegabyteCosts, wantMeg) {
+		t.Errorf("CalculateSplit(%v) MegabyteCosts == %v, want %v", bil.Split, got.MegabyteCosts, wantMeg)
+	}
+
+	wantShared := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(23.00),
+		"1112224444": decimal.NewFromFloat(13.00),
+	}
+	if !cmp.Equal(got.SharedCosts, wantShared) {
+		t.Errorf("CalculateSplit(%v) SharedCosts == %v, want %v", bil.Split, got.SharedCosts, wantShared)
+	}
+}
+
+func TestNewStrategyErrors(t *testing.T) {
+	cases := []tingbill.SplitPolicy{
+		{Strategy: "random"},
+		{Strategy: StrategyWeighted},
+		{Strategy: StrategyHybrid, EvenPercent: decimal.NewFromFloat(120)},
+	}
+
+	for _, c := range cases {
+		if _, err := NewStrategy(c, StrategyEven); err == nil {
+			t.Errorf("NewStrategy(%v) expected an error", c)
+		}
+	}
+}
+
+func TestParseBillAmounts(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    decimal.Decimal
+		wantErr bool
+	}{
+		{`total = 48`, decimal.NewFromFloat(48), false},
+		{`total = 48.00`, decimal.NewFromFloat(48), false},
+		{`total = "48.00"`, decimal.NewFromFloat(48), false},
+		{`total = 118.84`, decimal.NewFromFloat(118.84), false},
+		{`total = "$48.00"`, decimal.Zero, true},
+		{`total = "48.00.1"`, decimal.Zero, true},
+		{`total = true`, decimal.Zero, true},
+	}
+
+	for _, c := range cases {
+		in := c.in + `
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+		got, err := ParseBill(strings.NewReader(in))
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseBill(%v) expected an error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseBill(%v) err, %v", c.in, err)
+		}
+		if !got.Total.Equal(c.want) {
+			t.Errorf("ParseBill(%v) Total == %v, want %v", c.in, got.Total, c.want)
+		}
+	}
+}
+
+func TestCalculateSplitCharges(t *testing.T) {
+	in := `description = "Charges test"
+total = 65.50
+devicesCost = 20.00
+megabytes = 10.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[charges]]
+name = "Hotspot"
+amount = "6.00"
+category = "megabytes"
+
+[[charges]]
+name = "International pack"
+amount = 4
+category = "shared"
+strategy = "weighted"
+weights = { 1112223333 = 0, 1112224444 = 1 }
+
+[[charges]]
+name = "Phone installment"
+amount = 25.50
+deviceId = "1112223333"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{
+		"1112223333": 1000,
+		"1112224444": 3000,
+	}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Charges, err)
+	}
+
+	want := []tingbill.ChargeSplit{
+		{
+			Name:     "Hotspot",
+			Category: CategoryMegabytes,
+			Strategy: StrategyProportional,
+			Amount:   decimal.NewFromFloat(6),
+			Costs: map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(1.50),
+				"1112224444": decimal.NewFromFloat(4.50),
+			},
+		},
+		{
+			Name:     "International pack",
+			Category: CategoryShared,
+			Strategy: StrategyWeighted,
+			Amount:   decimal.NewFromFloat(4),
+			Costs: map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(0),
+				"1112224444": decimal.NewFromFloat(4),
+			},
+		},
+		{
+			Name:     "Phone installment",
+			Strategy: StrategyDevice,
+			DeviceID: "1112223333",
+			Amount:   decimal.NewFromFloat(25.50),
+			Costs: map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(25.50),
+			},
+		},
+	}
+	if !cmp.Equal(got.Charges, want) {
+		t.Errorf("CalculateSplit(%v) Charges == %v, want %v", bil.Charges, got.Charges, want)
+	}
+
+	wantDevice := decimal.NewFromFloat(25.50)
+	if got := got.DeviceChargeTotal("1112223333"); !got.Equal(wantDevice) {
+		t.Errorf("CalculateSplit(%v) DeviceChargeTotal == %v, want %v", bil.Charges, got, wantDevice)
+	}
+
+	total := got.DeviceTotal("1112223333").Add(got.DeviceTotal("1112224444"))
+	if !total.Equal(bil.Total) {
+		t.Errorf("CalculateSplit(%v) device totals sum to %v, want %v", bil.Charges, total, bil.Total)
+	}
+}
+
+func TestParseBillChargeErrors(t *testing.T) {
+	cases := []string{
+		`[[charges]]
+name = "No amount"
+category = "shared"`,
+		`[[charges]]
+name = "Bad amount"
+amount = "$4"
+category = "shared"`,
+		`[[charges]]
+name = "Bad category"
+amount = 4
+category = "bananas"`,
+		`[[charges]]
+name = "Unknown device"
+amount = 4
+deviceId = "9998887777"`,
+		`[[charges]]
+name = "Device with strategy"
+amount = 4
+deviceId = "1112223333"
+strategy = "even"`,
+		`[[charges]]
+name = "Shared proportional"
+amount = 4
+category = "shared"
+strategy = "proportional"`,
+	}
+
+	for _, c := range cases {
+		in := `[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+` + c
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+}
+
+func TestCalculateSplitCredits(t *testing.T) {
+	in := `description = "Credits test"
+total = 11.00
+devicesCost = 30.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+
+[[credits]]
+name = "Service credit"
+amount = 10.00
+category = "shared"
+
+[[credits]]
+name = "Data credit"
+amount = 3.00
+category = "megabytes"
+
+[[credits]]
+name = "Referral"
+amount = 5.00
+owner = "owner2"
+
+[[credits]]
+name = "Refund"
+amount = 1.00
+deviceId = "1112223333"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{
+		"1112223333": 1000,
+		"1112224444": 2000,
+	}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Credits, err)
+	}
+
+	want := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(-5.34),
+		"1112224444": decimal.NewFromFloat(-7.83),
+		"1112220000": decimal.NewFromFloat(-5.83),
+	}
+
+	total := decimal.Zero
+	for id, w := range want {
+		if got := got.CreditTotal(id); !got.Equal(w) {
+			t.Errorf("CalculateSplit(%v) CreditTotal(%s) == %v, want %v", bil.Credits, id, got, w)
+		}
+		total = total.Add(got.DeviceTotal(id))
+	}
+
+	if !total.Equal(bil.Total) {
+		t.Errorf("CalculateSplit(%v) device totals sum to %v, want %v", bil.Credits, total, bil.Total)
+	}
+
+	wantOwner := decimal.NewFromFloat(-13.66)
+	if got := got.OwnerCosts["owner2"].CreditCosts; !got.Equal(wantOwner) {
+		t.Errorf("CalculateSplit(%v) OwnerCosts[owner2].CreditCosts == %v, want %v", bil.Credits, got, wantOwner)
+	}
+}
+
+func TestCalculateSplitProration(t *testing.T) {
+	in := `description = "Proration test"
+total = 40.00
+devicesCost = 30.00
+fees = 10.00
+periodStart = "2019-09-01"
+periodEnd = "2019-09-30"
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+activeTo = "2019-09-15"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+activeFrom = "2019-08-01"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Devices, err)
+	}
+
+	wantProration := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(1),
+		"1112224444": decimal.NewFromFloat(0.5),
+		"1112220000": decimal.NewFromFloat(1),
+	}
+	if !cmp.Equal(got.Proration, wantProration) {
+		t.Errorf("CalculateSplit(%v) Proration == %v, want %v", bil.Devices, got.Proration, wantProration)
+	}
+
+	wantShared := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(16.00),
+		"1112224444": decimal.NewFromFloat(8.00),
+		"1112220000": decimal.NewFromFloat(16.00),
+	}
+	if !cmp.Equal(got.SharedCosts, wantShared) {
+		t.Errorf("CalculateSplit(%v) SharedCosts == %v, want %v", bil.Devices, got.SharedCosts, wantShared)
+	}
+}
+
+func TestCalculateSplitProrationFromUsage(t *testing.T) {
+	in := `description = "Proration from usage test"
+total = 30.00
+devicesCost = 30.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+activeTo = "2019-09-15"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	u := Usage{
+		Minutes: []MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 1, Date: time.Date(2019, 9, 1, 10, 0, 0, 0, time.UTC)},
+			{DeviceID: "1112224444", Minutes: 1, Date: time.Date(2019, 9, 30, 10, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	// Without a billing period there's nothing to prorate activeTo by
+	if _, err := CalculateSplit(u, bil); err == nil {
+		t.Errorf("CalculateSplit(%v) expected an error without a billing period", bil.Devices)
+	}
+
+	bil, _ = WithUsagePeriod(bil, u)
+
+	got, err := CalculateSplit(u, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Devices, err)
+	}
+
+	wantProration := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(1),
+		"1112224444": decimal.NewFromFloat(0.5),
+	}
+	if !cmp.Equal(got.Proration, wantProration) {
+		t.Errorf("CalculateSplit(%v) Proration == %v, want %v", bil.Devices, got.Proration, wantProration)
+	}
+}
+
+func TestParseBillPeriodErrors(t *testing.T) {
+	cases := []string{
+		`periodStart = "2019-09-01"`,
+		`periodStart = "2019-09-30"
+periodEnd = "2019-09-01"`,
+		`periodStart = "09/01/2019"
+periodEnd = "2019-09-30"`,
+		`[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+activeFrom = "2019-09-15"
+activeTo = "2019-09-01"`,
+	}
+
+	for _, c := range cases {
+		in := c + `
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+}
+
+func TestCalculateSplitPayers(t *testing.T) {
+	in := `description = "Payers test"
+total = 30.01
+devicesCost = 30.01
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "parent"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "kid"
+payers = { parent = 100 }
+
+[[devices]]
+deviceId = "1112220000"
+owner = "couple"
+payers = { alice = 50, bob = 50 }`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Devices, err)
+	}
+
+	want := map[string]map[string]decimal.Decimal{
+		"parent": map[string]decimal.Decimal{
+			"1112223333": decimal.NewFromFloat(10.01),
+			"1112224444": decimal.NewFromFloat(10),
+		},
+		"alice": map[string]decimal.Decimal{
+			"1112220000": decimal.NewFromFloat(5),
+		},
+		"bob": map[string]decimal.Decimal{
+			"1112220000": decimal.NewFromFloat(5),
+		},
+	}
+	if !cmp.Equal(got.PayerCosts, want) {
+		t.Errorf("CalculateSplit(%v) PayerCosts == %v, want %v", bil.Devices, got.PayerCosts, want)
+	}
+
+	wantPayers := []string{"parent", "alice", "bob"}
+	if !cmp.Equal(bil.Payers(), wantPayers) {
+		t.Errorf("Payers() == %v, want %v", bil.Payers(), wantPayers)
+	}
+
+	wantTotal := decimal.NewFromFloat(20.01)
+	if got := got.PayerTotal("parent"); !got.Equal(wantTotal) {
+		t.Errorf("CalculateSplit(%v) PayerTotal(parent) == %v, want %v", bil.Devices, got, wantTotal)
+	}
+}
+
+func TestParseBillPayerErrors(t *testing.T) {
+	cases := []string{
+		`payers = { alice = 50, bob = 40 }`,
+		`payers = { alice = 100, bob = 0 }`,
+		`payers = { alice = "half" }`,
+	}
+
+	for _, c := range cases {
+		in := `[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+` + c
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+}
+
+func TestCalculateSplitTiered(t *testing.T) {
+	in := `description = "Tiered test"
+total = 18.00
+minutes = 18.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+
+[split.minutes]
+strategy = "tiered"
+
+[[split.minutes.tiers]]
+upTo = 100
+cost = 3
+
+[[split.minutes.tiers]]
+upTo = 500
+cost = 9.00
+
+[[split.minutes.tiers]]
+upTo = 1000
+cost = "18.00"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{
+		"1112223333": 50,
+		"1112224444": 100,
+		"1112220000": 400,
+	}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Split.Minutes, err)
+	}
+
+	want := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(0.27),
+		"1112224444": decimal.NewFromFloat(1.21),
+		"1112220000": decimal.NewFromFloat(16.52),
+	}
+	if !cmp.Equal(got.MinuteCosts, want) {
+		t.Errorf("CalculateSplit(%v) MinuteCosts == %v, want %v", bil.Split.Minutes, got.MinuteCosts, want)
+	}
+}
+
+func TestCheckTiers(t *testing.T) {
+	cases := []struct {
+		tiers   []tingbill.Tier
+		wantErr bool
+	}{
+		{nil, true},
+		{[]tingbill.Tier{{UpTo: 100, Cost: decimal.NewFromFloat(3)}}, false},
+		{[]tingbill.Tier{{UpTo: 100, Cost: decimal.NewFromFloat(3)}, {UpTo: 100, Cost: decimal.NewFromFloat(9)}}, true},
+		{[]tingbill.Tier{{UpTo: 100, Cost: decimal.NewFromFloat(9)}, {UpTo: 500, Cost: decimal.NewFromFloat(3)}}, true},
+	}
+
+	for _, c := range cases {
+		if err := checkTiers(c.tiers); (err != nil) != c.wantErr {
+			t.Errorf("checkTiers(%v) == %v, want error %v", c.tiers, err, c.wantErr)
+		}
+	}
+}
+
+func TestCalculateSplitShapley(t *testing.T) {
+	in := `description = "Shapley test"
+total = 18.00
+minutes = 18.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+
+[split.minutes]
+strategy = "shapley"
+
+[[split.minutes.tiers]]
+upTo = 100
+cost = 3
+
+[[split.minutes.tiers]]
+upTo = 500
+cost = 9
+
+[[split.minutes.tiers]]
+upTo = 1000
+cost = 18`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{
+		"1112223333": 50,
+		"1112224444": 100,
+		"1112220000": 400,
+	}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Split.Minutes, err)
+	}
+
+	want := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(5),
+		"1112224444": decimal.NewFromFloat(5),
+		"1112220000": decimal.NewFromFloat(8),
+	}
+	if !cmp.Equal(got.MinuteCosts, want) {
+		t.Errorf("CalculateSplit(%v) MinuteCosts == %v, want %v", bil.Split.Minutes, got.MinuteCosts, want)
+	}
+}
+
+func TestShapleyStrategySampled(t *testing.T) {
+	s := ShapleyStrategy{
+		Tiers: []tingbill.Tier{
+			{UpTo: 100, Cost: decimal.NewFromFloat(3)},
+			{UpTo: 500, Cost: decimal.NewFromFloat(9)},
+			{UpTo: 1000, Cost: decimal.NewFromFloat(18)},
+		},
+	}
+
+	var ids []string
+	usage := make(map[string]decimal.Decimal)
+	for i := 0; i <= ShapleyExactLimit; i++ {
+		id := fmt.Sprintf("11122200%02d", i)
+		ids = append(ids, id)
+		usage[id] = decimal.New(60, 0)
+	}
+	usage[ids[0]] = decimal.Zero
+
+	w, err := s.Weights(ids, usage)
+	if err != nil {
+		t.Fatalf("Weights(%v, %v) err, %v", ids, usage, err)
+	}
+
+	total := decimal.Zero
+	for _, id := range ids {
+		total = total.Add(w[id])
+	}
+
+	if !total.Round(8).Equal(decimal.New(18, 0)) {
+		t.Errorf("Weights(%v, %v) total == %v, want 18", ids, usage, total)
+	}
+
+	if !w[ids[0]].IsZero() {
+		t.Errorf("Weights(%v, %v)[%s] == %v, want 0", ids, usage, ids[0], w[ids[0]])
+	}
+
+	got, err := allocateCents(decimal.New(18, 0), ids, w, RemainderLargest, ids[1])
+	if err != nil {
+		t.Fatalf("allocateCents(18, %v) err, %v", w, err)
+	}
+
+	for _, id := range ids[1:] {
+		if got[id].LessThan(decimal.NewFromFloat(1.5)) || got[id].GreaterThan(decimal.NewFromFloat(2.1)) {
+			t.Errorf("allocateCents(18, %v)[%s] == %v, want close to 1.80", w, id, got[id])
+		}
+	}
+}
+
+func TestCalculateSplitAudit(t *testing.T) {
+	in := `description = "Audit test"
+total = 16.00
+minutes = 10.00
+devicesCost = 6.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[charges]]
+name = "Case"
+amount = 2.50
+deviceId = "1112224444"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1, "1112224444": 2}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil, err)
+	}
+
+	steps := got.Audit["1112224444"]
+	if len(steps) != 6 {
+		t.Fatalf("CalculateSplit(%v) Audit has %d steps, want 6", bil, len(steps))
+	}
+
+	wantMinutes := tingbill.AuditStep{
+		Item:        "Minutes",
+		Strategy:    StrategyProportional,
+		Amount:      decimal.NewFromFloat(10),
+		UsageBased:  true,
+		Usage:       decimal.New(2, 0),
+		TotalUsage:  decimal.New(3, 0),
+		Weight:      decimal.New(2, 0),
+		TotalWeight: decimal.New(3, 0),
+		Percent:     decimal.RequireFromString("66.6666666666666667"),
+		Exact:       decimal.RequireFromString("6.6666666666666667"),
+		Rounded:     decimal.NewFromFloat(6.66),
+		Adjustment:  decimal.NewFromFloat(0.01),
+		Share:       decimal.NewFromFloat(6.67),
+	}
+	if !cmp.Equal(steps[0], wantMinutes) {
+		t.Errorf("CalculateSplit(%v) Audit[0] == %v, want %v", bil, steps[0], wantMinutes)
+	}
+
+	if steps[5].Item != `Charge "Case"` || steps[5].Strategy != StrategyDevice || !steps[5].Share.Equal(decimal.NewFromFloat(2.5)) {
+		t.Errorf("CalculateSplit(%v) Audit[5] == %v, want the Case charge", bil, steps[5])
+	}
+
+	// Every device's audit trail adds up to what it owes
+	for _, id := range bil.DeviceIds() {
+		sum := decimal.Zero
+		for _, s := range got.Audit[id] {
+			sum = sum.Add(s.Share)
+		}
+
+		if !sum.Equal(got.DeviceTotal(id)) {
+			t.Errorf("CalculateSplit(%v) Audit for %s sums to %v, want %v", bil, id, sum, got.DeviceTotal(id))
+		}
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	// Each parser is wrapped to return its usage totals
+	parseMinutes := func(r io.Reader) (map[string]decimal.Decimal, []tingbill.Warning, error) {
+		records, warnings, err := ParseMinutes(r, ParseOptions{})
+		m, _, _ := minuteUsage(records, tingbill.CountingPolicy{})
+		return m, warnings, err
+	}
+
+	parseMessages := func(r io.Reader) (map[string]decimal.Decimal, []tingbill.Warning, error) {
+		records, warnings, err := ParseMessages(r, ParseOptions{})
+		m, _, _ := messageUsage(records, tingbill.CountingPolicy{})
+		return m, warnings, err
+	}
+
+	parseMegabytes := func(r io.Reader) (map[string]decimal.Decimal, []tingbill.Warning, error) {
+		records, warnings, err := ParseMegabytes(r, ParseOptions{})
+		m, _, _ := networkUsage(records, tingbill.Bill{})
+		return decimalUsage(m), warnings, err
+	}
+
+	cases := []struct {
+		name  string
+		parse func(r io.Reader) (map[string]decimal.Decimal, []tingbill.Warning, error)
+		in    string
+		want  []string
+	}{
+		{"minutes empty", parseMinutes, "", []string{WarnEmptyFile}},
+		{"messages empty", parseMessages, "", []string{WarnEmptyFile}},
+		{"megabytes empty", parseMegabytes, "", []string{WarnEmptyFile}},
+		{"minutes no rows", parseMinutes, "Phone,Duration (min)", []string{WarnNoRows}},
+		{"messages no rows", parseMessages, "Phone", []string{WarnNoRows}},
+		{"megabytes no rows", parseMegabytes, "Device,Kilobytes", []string{WarnNoRows}},
+		{"minutes", parseMinutes, "Phone,Duration (min)\n1112223333,2", nil},
+	}
+
+	for _, c := range cases {
+		got, warnings, err := c.parse(strings.NewReader(c.in))
+		if err != nil {
+			t.Errorf("%s: err, %v", c.name, err)
+		}
+
+		if len(got) != 0 && c.want != nil {
+			t.Errorf("%s: usage == %v, want none", c.name, got)
+		}
+
+		var codes []string
+		for _, w := range warnings {
+			codes = append(codes, w.Code)
+		}
+
+		if !cmp.Equal(codes, c.want) {
+			t.Errorf("%s: warnings == %v, want %v", c.name, codes, c.want)
+		}
+	}
+}
+
+func TestCalculateSplitWarnings(t *testing.T) {
+	in := `description = "Warnings test"
+total = 10.00
+minutes = 10.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	min := map[string]int{"1112223333": 1, "1112224444": 2, "9998887777": 5}
+	msg := map[string]int{"1112223333": 1}
+	meg := map[string]int{"1112223333": 1}
+
+	got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil, err)
+	}
+
+	want := []tingbill.Warning{
+		{
+			Code:     WarnUnknownDevice,
+			Severity: tingbill.SeverityWarning,
+			Message:  "minutes usage for deviceId 9998887777, which isn't on the bill, is left out of the split",
+			Context:  map[string]string{"category": CategoryMinutes, "deviceId": "9998887777", "usage": "5"},
+		},
+		{
+			Code:     WarnNoUsage,
+			Severity: tingbill.SeverityInfo,
+			Message:  "deviceId 1112220000 has no usage for the billing period",
+			Context:  map[string]string{"deviceId": "1112220000"},
+		},
+		{
+			Code:     WarnRemainder,
+			Severity: tingbill.SeverityInfo,
+			Message:  "leftover cents when splitting Minutes went to 1112224444",
+			Context:  map[string]string{"item": "Minutes", "deviceIds": "1112224444"},
+		},
+	}
+
+	if !cmp.Equal(got.Warnings, want) {
+		t.Errorf("CalculateSplit(%v) Warnings == %v, want %v", bil, got.Warnings, want)
+	}
+}
+
+func TestCalculateSplitZeroUsage(t *testing.T) {
+	zero := decimal.Zero
+	one := decimal.NewFromFloat(1)
+
+	cases := []struct {
+		policy     string
+		strategy   string
+		wantMsg    map[string]decimal.Decimal
+		wantShared map[string]decimal.Decimal
+		wantCharge map[string]decimal.Decimal
+	}{
+		{
+			"",
+			"",
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": zero, "1112220000": zero},
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+		},
+		{
+			ZeroUsageShortStraw,
+			"",
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": decimal.NewFromFloat(3), "1112220000": zero},
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": zero, "1112220000": zero},
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": decimal.NewFromFloat(3), "1112220000": zero},
+		},
+		{
+			ZeroUsageShared,
+			"",
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": zero, "1112220000": zero},
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+		},
+		{
+			// Without an evenPercent, hybrid only splits by usage
+			"",
+			StrategyHybrid,
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+			map[string]decimal.Decimal{"1112223333": zero, "1112224444": zero, "1112220000": zero},
+			map[string]decimal.Decimal{"1112223333": one, "1112224444": one, "1112220000": one},
+		},
+	}
+
+	for _, c := range cases {
+		in := fmt.Sprintf(`description = "Zero usage test"
+total = 9.00
+minutes = 3.00
+messages = 3.00
+shortStrawId = "1112224444"
+zeroUsagePolicy = %[1]q
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+
+[[charges]]
+name = "International texts"
+amount = 3.00
+category = "messages"
+strategy = %[2]q
+
+[split.messages]
+strategy = %[2]q`, c.policy, c.strategy, c.strategy)
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("ParseBill(%v) err, %v", in, err)
+		}
+
+		min := map[string]int{"1112223333": 1, "1112224444": 1, "1112220000": 1}
+
+		got, err := CalculateSplit(testUsage(min, nil, nil), bil)
+		if err != nil {
+			t.Errorf("CalculateSplit(%s, %s) err, %v", c.policy, c.strategy, err)
+			continue
+		}
+
+		if !cmp.Equal(got.MessageCosts, c.wantMsg) {
+			t.Errorf("CalculateSplit(%s, %s) MessageCosts == %v, want %v", c.policy, c.strategy, got.MessageCosts, c.wantMsg)
+		}
+
+		if !cmp.Equal(got.SharedCosts, c.wantShared) {
+			t.Errorf("CalculateSplit(%s, %s) SharedCosts == %v, want %v", c.policy, c.strategy, got.SharedCosts, c.wantShared)
+		}
+
+		if !cmp.Equal(got.Charges[0].Costs, c.wantCharge) {
+			t.Errorf("CalculateSplit(%s, %s) charge Costs == %v, want %v", c.policy, c.strategy, got.Charges[0].Costs, c.wantCharge)
+		}
+
+		if !got.MessagePercent["1112223333"].IsZero() {
+			t.Errorf("CalculateSplit(%s, %s) MessagePercent == %v, want 0", c.policy, c.strategy, got.MessagePercent)
+		}
+
+		// Messages and the charge, while megabytes has no cost to split
+		if len(got.ZeroUsage) != 2 || got.ZeroUsage[0].Item != "Messages" {
+			t.Errorf("CalculateSplit(%s, %s) ZeroUsage == %v, want Messages and the charge", c.policy, c.strategy, got.ZeroUsage)
+		}
+	}
+}
+
+func TestParseBillZeroUsagePolicyError(t *testing.T) {
+	in := `zeroUsagePolicy = "nobody"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+	if _, err := ParseBill(strings.NewReader(in)); err == nil {
+		t.Errorf("ParseBill(%v) expected an error", in)
+	}
+}
+
+func TestCalculateSplitLimits(t *testing.T) {
+	base := `description = "Limits test"
+total = 110.00
+minutes = 80.00
+devicesCost = 30.00
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "grandparents"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112220000"
+owner = "owner2"
+`
+
+	cases := []struct {
+		name       string
+		head       string
+		tail       string
+		want       map[string]decimal.Decimal
+		wantLimits []string
+	}{
+		{
+			"no limits",
+			"",
+			"",
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(50),
+				"1112224444": decimal.NewFromFloat(20),
+				"1112220000": decimal.NewFromFloat(40),
+			},
+			nil,
+		},
+		{
+			"owner cap",
+			"",
+			`[owners.grandparents]
+cap = 25`,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(25),
+				"1112224444": decimal.NewFromFloat(27.5),
+				"1112220000": decimal.NewFromFloat(57.5),
+			},
+			[]string{"grandparents would have paid $50.00, the cap of $25.00 moved $25.00 to the other lines"},
+		},
+		{
+			"cap pushes another line over its cap",
+			"",
+			`[owners.grandparents]
+cap = 25
+
+[owners.owner2]
+cap = "50.00"`,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(25),
+				"1112224444": decimal.NewFromFloat(35),
+				"1112220000": decimal.NewFromFloat(50),
+			},
+			[]string{
+				"grandparents would have paid $50.00, the cap of $25.00 moved $25.00 to the other lines",
+				"owner2 would have paid $57.50, the cap of $50.00 moved $7.50 to the other lines",
+			},
+		},
+		{
+			"floor of the devices share",
+			"floorDevicesShare = true",
+			`[[credits]]
+name = "Referral"
+amount = 15
+owner = "owner1"`,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(47.32),
+				"1112224444": decimal.NewFromFloat(10),
+				"1112220000": decimal.NewFromFloat(37.68),
+			},
+			[]string{"1112224444 would have paid $5.00, the floor of $10.00 moved $5.00 from the other lines"},
+		},
+		{
+			"floor of the devices share under a credit",
+			"floorDevicesShare = true",
+			`[[credits]]
+name = "Referral"
+amount = 30
+owner = "owner1"`,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(39.29),
+				"1112224444": decimal.NewFromFloat(10),
+				"1112220000": decimal.NewFromFloat(30.71),
+			},
+			[]string{"1112224444 would have paid -$10.00, the floor of $10.00 moved $20.00 from the other lines"},
+		},
+	}
+
+	for _, c := range cases {
+		in := c.head + "\n" + base + "\n" + c.tail
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: ParseBill(%v) err, %v", c.name, in, err)
+		}
+
+		min := map[string]int{"1112223333": 4, "1112224444": 1, "1112220000": 3}
+		msg := map[string]int{"1112223333": 1}
+		meg := map[string]int{"1112223333": 1}
+
+		got, err := CalculateSplit(testUsage(min, msg, meg), bil)
+		if err != nil {
+			t.Errorf("%s: CalculateSplit err, %v", c.name, err)
+			continue
+		}
+
+		totals := make(map[string]decimal.Decimal)
+		for _, id := range bil.DeviceIds() {
+			totals[id] = got.DeviceTotal(id)
+		}
+
+		if !cmp.Equal(totals, c.want) {
+			t.Errorf("%s: DeviceTotal == %v, want %v", c.name, totals, c.want)
+		}
+
+		if len(got.Limits) != len(c.wantLimits) {
+			t.Errorf("%s: Limits == %v, want %d of them", c.name, got.Limits, len(c.wantLimits))
+		}
+
+		var messages []string
+		for _, w := range got.Warnings {
+			if w.Code == WarnLimit {
+				messages = append(messages, w.Message)
+			}
+		}
+
+		if !cmp.Equal(messages, c.wantLimits) {
+			t.Errorf("%s: %s warnings == %q, want %q", c.name, WarnLimit, messages, c.wantLimits)
+		}
+	}
+}
+
+func TestCalculateSplitFloorDevicesShareOverCap(t *testing.T) {
+	in := `description = "Limits test"
+total = 30.00
+devicesCost = 30.00
+shortStrawId = "1112223333"
+floorDevicesShare = true
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+cap = 5
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	if _, err := CalculateSplit(testUsage(nil, nil, nil), bil); err == nil {
+		t.Errorf("CalculateSplit() expected an error for a cap under the devicesCost share")
+	}
+}
+
+func TestParseBillLimitErrors(t *testing.T) {
+	cases := []string{
+		`[owners.nobody]
+cap = 25`,
+		`[owners.owner1]
+cap = "$25"`,
+		`[owners.owner1]
+cap = 10
+floor = 20`,
+		`[owners.owner1]
+floor = -5`,
+	}
+
+	for _, c := range cases {
+		in := `[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+cap = 30
+
+` + c
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+}
+
+func TestCalculateSplitNetworkWeights(t *testing.T) {
+	in := `description = "Network weights test"
+total = 30.00
+megabytes = 30.00
+shortStrawId = "1112223333"
+
+[networkWeights]
+"3G" = 0.5
+"2G" = 0
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	meg := []MegabyteRecord{
+		{DeviceID: "1112223333", Kilobytes: 1000, Type: "4G LTE"},
+		{DeviceID: "1112223333", Kilobytes: 2000, Type: "3G"},
+		{DeviceID: "1112223333", Kilobytes: 5000, Type: "2G"},
+		{DeviceID: "1112224444", Kilobytes: 1000, Type: "4G LTE"},
+		{DeviceID: "1112224444", Kilobytes: 1000, Type: "4G LTE"},
+	}
+
+	got, err := CalculateSplit(Usage{Megabytes: meg}, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.NetworkWeights, err)
+	}
+
+	wantQty := map[string]int{"1112223333": 8000, "1112224444": 2000}
+	if !cmp.Equal(got.MegabyteQty, wantQty) {
+		t.Errorf("CalculateSplit(%v) MegabyteQty == %v, want %v", bil.NetworkWeights, got.MegabyteQty, wantQty)
+	}
+
+	wantTypes := map[string]map[string]int{
+		"1112223333": {"4G LTE": 1000, "3G": 2000, "2G": 5000},
+		"1112224444": {"4G LTE": 2000},
+	}
+	if !cmp.Equal(got.MegabyteTypeQty, wantTypes) {
+		t.Errorf("CalculateSplit(%v) MegabyteTypeQty == %v, want %v", bil.NetworkWeights, got.MegabyteTypeQty, wantTypes)
+	}
+
+	wantWeighted := map[string]int{"1112223333": 2000, "1112224444": 2000}
+	if !cmp.Equal(got.MegabyteWeightedQty, wantWeighted) {
+		t.Errorf("CalculateSplit(%v) MegabyteWeightedQty == %v, want %v", bil.NetworkWeights, got.MegabyteWeightedQty, wantWeighted)
+	}
+
+	wantCosts := map[string]decimal.Decimal{
+		"1112223333": decimal.NewFromFloat(15),
+		"1112224444": decimal.NewFromFloat(15),
+	}
+	if !cmp.Equal(got.MegabyteCosts, wantCosts) {
+		t.Errorf("CalculateSplit(%v) MegabyteCosts == %v, want %v", bil.NetworkWeights, got.MegabyteCosts, wantCosts)
+	}
+
+	wantTypeList := []string{"2G", "3G", "4G LTE"}
+	if types := got.NetworkTypes(); !cmp.Equal(types, wantTypeList) {
+		t.Errorf("NetworkTypes() == %v, want %v", types, wantTypeList)
+	}
+
+	in = strings.Replace(in, `"2G" = 0`, `"2G" = -1`, 1)
+	if _, err := ParseBill(strings.NewReader(in)); err == nil {
+		t.Errorf("ParseBill(%v) expected an error for a negative network weight", in)
+	}
+}
+
+func TestCalculateSplitSurcharges(t *testing.T) {
+	u := Usage{
+		Minutes: []MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 10, Surcharge: decimal.NewFromFloat(1)},
+			{DeviceID: "1112224444", Minutes: 10},
+		},
+		Messages: []MessageRecord{
+			{DeviceID: "1112224444", Surcharge: decimal.NewFromFloat(0.25)},
+		},
+		Megabytes: []MegabyteRecord{
+			{DeviceID: "1112223333", Kilobytes: 100, Surcharge: decimal.NewFromFloat(0.5)},
+		},
+	}
+
+	cases := []struct {
+		surchargesFrom string
+		fees           float64
+		wantShared     map[string]decimal.Decimal
+		wantErr        bool
+	}{
+		{
+			"",
+			10,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(19.13),
+				"1112224444": decimal.NewFromFloat(19.12),
+			},
+			false,
+		},
+		{
+			"devicesCost",
+			10,
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(19.13),
+				"1112224444": decimal.NewFromFloat(19.12),
+			},
+			false,
+		},
+		{
+			"fees",
+			1,
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		in := fmt.Sprintf(`description = "Surcharges test"
+total = %.2f
+devicesCost = 30.00
+fees = %.2f
+surchargesFrom = %q
+shortStrawId = "1112223333"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`, 30+c.fees, c.fees, c.surchargesFrom)
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("ParseBill(%v) err, %v", in, err)
+		}
+
+		got, err := CalculateSplit(u, bil)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("CalculateSplit(%q) expected an error", c.surchargesFrom)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("CalculateSplit(%q) err, %v", c.surchargesFrom, err)
+		}
+
+		wantSurcharges := map[string]decimal.Decimal{
+			"1112223333": decimal.NewFromFloat(1.5),
+			"1112224444": decimal.NewFromFloat(0.25),
+		}
+		if !cmp.Equal(got.SurchargeCosts, wantSurcharges) {
+			t.Errorf("CalculateSplit(%q) SurchargeCosts == %v, want %v", c.surchargesFrom, got.SurchargeCosts, wantSurcharges)
+		}
+
+		if !cmp.Equal(got.SharedCosts, c.wantShared) {
+			t.Errorf("CalculateSplit(%q) SharedCosts == %v, want %v", c.surchargesFrom, got.SharedCosts, c.wantShared)
+		}
+
+		total := got.DeviceTotal("1112223333").Add(got.DeviceTotal("1112224444"))
+		if !total.Equal(bil.Total) {
+			t.Errorf("CalculateSplit(%q) device totals sum to %v, want %v", c.surchargesFrom, total, bil.Total)
+		}
+	}
+}
+
+func TestCalculateSplitInternational(t *testing.T) {
+	u := Usage{
+		Minutes: []MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 10, Country: "USA", PartnerCountry: "United States of America"},
+			{DeviceID: "1112223333", Minutes: 5, Country: "USA", PartnerCountry: "Mexico"},
+			{DeviceID: "1112224444", Minutes: 10, Country: "USA", PartnerCountry: "USA"},
+		},
+		Messages: []MessageRecord{
+			{DeviceID: "1112223333"},
+			{DeviceID: "1112223333"},
+			{DeviceID: "1112224444", Roaming: true, RoamingCountry: "Canada"},
+			{DeviceID: "1112224444", Roaming: true, RoamingCountry: "Canada"},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		total   float64
+		intl    string
+		wantMin map[string]decimal.Decimal
+		wantMsg map[string]decimal.Decimal
+	}{
+		{
+			"rates",
+			15,
+			"minuteRate = 0.20\nmessageRate = 0.50",
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(5.5),
+				"1112224444": decimal.NewFromFloat(4.5),
+			},
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(4),
+				"1112224444": decimal.NewFromFloat(1),
+			},
+		},
+		{
+			"bill line",
+			18,
+			"minutes = 3.00",
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(9),
+				"1112224444": decimal.NewFromFloat(4),
+			},
+			map[string]decimal.Decimal{
+				"1112223333": decimal.NewFromFloat(2.5),
+				"1112224444": decimal.NewFromFloat(2.5),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		in := fmt.Sprintf(`description = "International test"
+total = %.2f
+minutes = 10.00
+messages = 5.00
+shortStrawId = "1112223333"
+
+[international]
+%s
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`, c.total, c.intl)
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: ParseBill(%v) err, %v", c.name, in, err)
+		}
+
+		got, err := CalculateSplit(u, bil)
+		if err != nil {
+			t.Fatalf("%s: CalculateSplit err, %v", c.name, err)
+		}
+
+		if !cmp.Equal(got.MinuteCosts, c.wantMin) {
+			t.Errorf("%s: MinuteCosts == %v, want %v", c.name, got.MinuteCosts, c.wantMin)
+		}
+
+		if !cmp.Equal(got.MessageCosts, c.wantMsg) {
+			t.Errorf("%s: MessageCosts == %v, want %v", c.name, got.MessageCosts, c.wantMsg)
+		}
+
+		wantCountries := map[string][]string{"1112223333": {"Mexico"}, "1112224444": {"Canada"}}
+		if !cmp.Equal(got.InternationalCountries, wantCountries) {
+			t.Errorf("%s: InternationalCountries == %v, want %v", c.name, got.InternationalCountries, wantCountries)
+		}
+
+		total := got.DeviceTotal("1112223333").Add(got.DeviceTotal("1112224444"))
+		if !total.Equal(bil.Total) {
+			t.Errorf("%s: device totals sum to %v, want %v", c.name, total, bil.Total)
+		}
+	}
+
+	in := `[international]
+minutes = 3.00
+minuteRate = 0.20
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+	if _, err := ParseBill(strings.NewReader(in)); err == nil {
+		t.Errorf("ParseBill(%v) expected an error for a rate and an amount", in)
+	}
+}
+
+func TestCalculateSplitCounting(t *testing.T) {
+	u := Usage{
+		Minutes: []MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 10, Direction: DirectionOutgoing},
+			{DeviceID: "1112223333", Minutes: 20, Direction: DirectionIncoming},
+			{DeviceID: "1112224444", Minutes: 5, Direction: DirectionOutgoing},
+			{DeviceID: "1112224444", Minutes: 5, Direction: DirectionIncoming},
+		},
+	}
+
+	cases := []struct {
+		counting string
+		wantQty  map[string]decimal.Decimal
+		want     map[string]decimal.Decimal
+	}{
+		{
+			"",
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(30), "1112224444": decimal.NewFromFloat(10)},
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(22.5), "1112224444": decimal.NewFromFloat(7.5)},
+		},
+		{
+			`policy = "outgoing"`,
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(10), "1112224444": decimal.NewFromFloat(5)},
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(20), "1112224444": decimal.NewFromFloat(10)},
+		},
+		{
+			`policy = "incoming"`,
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(20), "1112224444": decimal.NewFromFloat(5)},
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(24), "1112224444": decimal.NewFromFloat(6)},
+		},
+		{
+			`policy = "weighted"
+outgoing = 1
+incoming = 0.5`,
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(20), "1112224444": decimal.NewFromFloat(7.5)},
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(21.82), "1112224444": decimal.NewFromFloat(8.18)},
+		},
+	}
+
+	for _, c := range cases {
+		in := `description = "Counting test"
+total = 30.00
+minutes = 30.00
+shortStrawId = "1112223333"
+
+[counting.minutes]
+` + c.counting + `
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("ParseBill(%v) err, %v", in, err)
+		}
+
+		got, err := CalculateSplit(u, bil)
+		if err != nil {
+			t.Fatalf("CalculateSplit(%v) err, %v", bil.Counting, err)
+		}
+
+		if !cmp.Equal(got.MinuteQty, c.wantQty) {
+			t.Errorf("CalculateSplit(%v) MinuteQty == %v, want %v", bil.Counting, got.MinuteQty, c.wantQty)
+		}
+
+		if !cmp.Equal(got.MinuteCosts, c.want) {
+			t.Errorf("CalculateSplit(%v) MinuteCosts == %v, want %v", bil.Counting, got.MinuteCosts, c.want)
+		}
+
+		wantOut := map[string]int{"1112223333": 10, "1112224444": 5}
+		wantIn := map[string]int{"1112223333": 20, "1112224444": 5}
+		if !cmp.Equal(got.MinuteOutQty, wantOut) || !cmp.Equal(got.MinuteInQty, wantIn) {
+			t.Errorf("CalculateSplit(%v) MinuteOutQty, MinuteInQty == %v, %v, want %v, %v", bil.Counting, got.MinuteOutQty, got.MinuteInQty, wantOut, wantIn)
+		}
+	}
+}
+
+func TestCalculateSplitFractionalCounting(t *testing.T) {
+	// Rounded to whole messages, 1112223333 would count as 0 and 1112224444 as 1
+	u := Usage{
+		Messages: []MessageRecord{
+			{DeviceID: "1112223333", Direction: DirectionIncoming},
+			{DeviceID: "1112224444", Direction: DirectionIncoming},
+			{DeviceID: "1112224444", Direction: DirectionIncoming},
+		},
+	}
+
+	in := `description = "Fractional counting test"
+total = 3.00
+messages = 3.00
+shortStrawId = "1112223333"
+
+[counting.messages]
+policy = "weighted"
+outgoing = 1
+incoming = 0.3
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	got, err := CalculateSplit(u, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil.Counting, err)
+	}
+
+	wantQty := map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(0.3), "1112224444": decimal.NewFromFloat(0.6)}
+	if !cmp.Equal(got.MessageQty, wantQty) {
+		t.Errorf("CalculateSplit(%v) MessageQty == %v, want %v", bil.Counting, got.MessageQty, wantQty)
+	}
+
+	want := map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(1), "1112224444": decimal.NewFromFloat(2)}
+	if !cmp.Equal(got.MessageCosts, want) {
+		t.Errorf("CalculateSplit(%v) MessageCosts == %v, want %v", bil.Counting, got.MessageCosts, want)
+	}
+
+	if len(got.ZeroUsage) != 0 {
+		t.Errorf("CalculateSplit(%v) ZeroUsage == %v, want none", bil.Counting, got.ZeroUsage)
+	}
+}
+
+func TestParseBillCountingError(t *testing.T) {
+	cases := []string{
+		`policy = "initiated"`,
+		`policy = "weighted"`,
+		`policy = "weighted"
+outgoing = -1
+incoming = 1`,
+	}
+
+	for _, c := range cases {
+		in := `[counting.messages]
+` + c + `
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+}
+
+func TestCalculateSplitUnknownDevices(t *testing.T) {
+	min := map[string]int{"1112223333": 10, "1112224444": 20, "9998887777": 30}
+
+	cases := []struct {
+		policy    string
+		wantErr   bool
+		want      map[string]decimal.Decimal
+		wantAdded []tingbill.Device
+	}{
+		{
+			"",
+			false,
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(10), "1112224444": decimal.NewFromFloat(20)},
+			nil,
+		},
+		{
+			UnknownDevicesAdd,
+			false,
+			map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(5), "1112224444": decimal.NewFromFloat(10), "9998887777": decimal.NewFromFloat(15)},
+			[]tingbill.Device{{DeviceID: "9998887777", Owner: tingbill.UnknownOwner}},
+		},
+		{
+			UnknownDevicesFail,
+			true,
+			nil,
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		in := `unknownDevices = "` + c.policy + `"
+total = 30.00
+minutes = 30.00
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("ParseBill(%v) err, %v", in, err)
+		}
+
+		got, err := CalculateSplit(testUsage(min, nil, nil), bil)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("CalculateSplit with unknownDevices %q expected an error", c.policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("CalculateSplit with unknownDevices %q err, %v", c.policy, err)
+		}
+
+		if !cmp.Equal(got.MinuteCosts, c.want) {
+			t.Errorf("CalculateSplit with unknownDevices %q MinuteCosts == %v, want %v", c.policy, got.MinuteCosts, c.want)
+		}
+
+		if !cmp.Equal(got.AddedDevices, c.wantAdded) {
+			t.Errorf("CalculateSplit with unknownDevices %q AddedDevices == %v, want %v", c.policy, got.AddedDevices, c.wantAdded)
+		}
+	}
+}
+
+func TestParseBillUnknownDevicesError(t *testing.T) {
+	cases := []string{
+		`unknownDevices = "guess"`,
+		`unknownDevices = "add"
+
+[split.minutes]
+strategy = "weighted"
+weights = { "1112223333" = 1 }`,
+		`unknownDevices = "add"
+
+[[charges]]
+name = "Hotspot"
+amount = 10.00
+category = "shared"
+strategy = "weighted"
+weights = { "1112223333" = 1 }`,
+	}
+
+	for _, c := range cases {
+		in := c + `
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", c)
+		}
+	}
+
+	// Weights only split between an owner's devices never include added devices
+	in := `unknownDevices = "add"
+
+[[charges]]
+name = "Hotspot"
+amount = 10.00
+owner = "owner1"
+strategy = "weighted"
+weights = { "1112223333" = 1 }
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+	if _, err := ParseBill(strings.NewReader(in)); err != nil {
+		t.Errorf("ParseBill(%v) err, %v", in, err)
+	}
+}
+
+func TestParseBillPhoneNumbers(t *testing.T) {
+	in := `shortStrawId = "+1 111 222 4444"
+
+[split.minutes]
+strategy = "weighted"
+weights = { "111-222-3333" = 2, "(111) 222-4444" = 1 }
+
+[[charges]]
+name = "Installment"
+amount = 10.00
+deviceId = "111.222.3333"
+
+[[devices]]
+deviceId = "111-222-3333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "(111) 222-4444"
+owner = "owner2"`
+
+	b, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	if got, want := b.DeviceIds(), []string{"1112223333", "1112224444"}; !cmp.Equal(got, want) {
+		t.Errorf("ParseBill(%v) deviceIds == %v, want %v", in, got, want)
+	}
+
+	if b.ShortStrawID != "1112224444" {
+		t.Errorf("ParseBill(%v) shortStrawId == %s, want 1112224444", in, b.ShortStrawID)
+	}
+
+	if got, want := b.Split.Minutes.Weights.Keys(), []string{"1112223333", "1112224444"}; !cmp.Equal(got, want) {
+		t.Errorf("ParseBill(%v) split.minutes weights == %v, want %v", in, got, want)
+	}
+
+	if b.Charges[0].DeviceID != "1112223333" {
+		t.Errorf("ParseBill(%v) charge deviceId == %s, want 1112223333", in, b.Charges[0].DeviceID)
+	}
+}
+
+func TestParseBillPhoneNumberErrors(t *testing.T) {
+	cases := []string{
+		`[[devices]]
+deviceId = "111-222-333"
+owner = "owner1"`,
+		`[[devices]]
+deviceId = "111-222-3333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner2"`,
+		`shortStrawId = "owner1"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`,
+	}
+
+	for _, in := range cases {
+		if _, err := ParseBill(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseBill(%v) expected an error", in)
+		}
+	}
+}
+
+func TestParsePhoneNumbers(t *testing.T) {
+	minutes := `Date,Time,Phone,Duration (min)
+09/03/2019,10:00 AM,(111) 222-3333,3
+09/03/2019,10:05 AM,+1 111 222 3333,2`
+
+	got, _, err := ParseMinutes(strings.NewReader(minutes), ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseMinutes(%v) err, %v", minutes, err)
+	}
+
+	for _, r := range got {
+		if r.DeviceID != "1112223333" {
+			t.Errorf("ParseMinutes(%v) deviceId == %s, want 1112223333", minutes, r.DeviceID)
+		}
+	}
+
+	bad := `Date,Time,Phone,Duration (min)
+09/03/2019,10:00 AM,222-3333,3`
+
+	if _, _, err := ParseMinutes(strings.NewReader(bad), ParseOptions{}); err == nil {
+		t.Errorf("ParseMinutes(%v) expected an error", bad)
+	}
+}
+
+func TestCalculateSplitPeriod(t *testing.T) {
+	in := `total = 10.00
+minutes = 10.00
+periodStart = "2019-09-03"
+periodEnd = "2019-10-02"
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"
+
+[[devices]]
+deviceId = "1112224444"
+owner = "owner2"`
+
+	bil, err := ParseBill(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseBill(%v) err, %v", in, err)
+	}
+
+	u := Usage{
+		Minutes: []MinuteRecord{
+			{DeviceID: "1112223333", Minutes: 50, Date: time.Date(2019, 9, 2, 23, 59, 0, 0, time.UTC)},
+			{DeviceID: "1112223333", Minutes: 1, Date: time.Date(2019, 9, 3, 0, 0, 0, 0, time.UTC)},
+			{DeviceID: "1112224444", Minutes: 2, Date: time.Date(2019, 10, 2, 23, 59, 0, 0, time.UTC)},
+			{DeviceID: "1112224444", Minutes: 50, Date: time.Date(2019, 10, 3, 0, 0, 0, 0, time.UTC)},
+			{DeviceID: "1112224444", Minutes: 2},
+		},
+		Megabytes: []MegabyteRecord{
+			{DeviceID: "1112223333", Kilobytes: 100, Date: time.Date(2019, 8, 20, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	got, err := CalculateSplit(u, bil)
+	if err != nil {
+		t.Fatalf("CalculateSplit(%v) err, %v", bil, err)
+	}
+
+	wantQty := map[string]decimal.Decimal{"1112223333": decimal.New(1, 0), "1112224444": decimal.New(4, 0)}
+	if !cmp.Equal(got.MinuteQty, wantQty) {
+		t.Errorf("CalculateSplit(%v) MinuteQty == %v, want %v", bil, got.MinuteQty, wantQty)
+	}
+
+	var excluded []map[string]string
+	for _, w := range got.Warnings {
+		if w.Code == WarnOutsidePeriod {
+			excluded = append(excluded, w.Context)
+		}
+	}
+
+	want := []map[string]string{
+		{"file": CategoryMinutes, "rows": "2"},
+		{"file": CategoryMegabytes, "rows": "1"},
+	}
+	if !cmp.Equal(excluded, want) {
+		t.Errorf("CalculateSplit(%v) %s warnings == %v, want %v", bil, WarnOutsidePeriod, excluded, want)
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	cases := []struct {
+		date    string
+		time    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"February 03, 2011", "01:11", time.Date(2011, 2, 3, 1, 11, 0, 0, time.UTC), false},
+		{"2019-09-03", "", time.Date(2019, 9, 3, 0, 0, 0, 0, time.UTC), false},
+		{"09/03/2019", "10:05 pm", time.Date(2019, 9, 3, 22, 5, 0, 0, time.UTC), false},
+		{"", "01:11", time.Time{}, false},
+		{"Feb 3rd", "", time.Time{}, true},
+		{"February 03, 2011", "noon", time.Time{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := parseDateTime([]string{c.date, c.time}, 0, 1)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseDateTime(%q, %q) expected an error", c.date, c.time)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseDateTime(%q, %q) err, %v", c.date, c.time, err)
+		} else if !got.Equal(c.want) {
+			t.Errorf("parseDateTime(%q, %q) == %v, want %v", c.date, c.time, got, c.want)
+		}
+	}
+}
+
+func TestWithUsagePeriod(t *testing.T) {
+	date := func(m time.Month, d int) time.Time { return time.Date(2019, m, d, 12, 0, 0, 0, time.UTC) }
+
+	u := Usage{
+		Minutes:   []MinuteRecord{{DeviceID: "1112223333", Minutes: 1, Date: date(9, 3)}, {DeviceID: "1112223333", Minutes: 1, Date: date(10, 2)}},
+		Messages:  []MessageRecord{{DeviceID: "1112223333", Date: date(9, 4)}, {DeviceID: "1112223333", Date: date(10, 1)}},
+		Megabytes: []MegabyteRecord{{DeviceID: "1112223333", Kilobytes: 1, Date: date(9, 3)}, {DeviceID: "1112223333", Kilobytes: 1, Date: date(9, 30)}, {DeviceID: "1112223333", Kilobytes: 1}},
+	}
+
+	uneven := Usage{
+		Minutes:  u.Minutes,
+		Messages: []MessageRecord{{DeviceID: "1112223333", Date: date(8, 20)}, {DeviceID: "1112223333", Date: date(9, 2)}},
+	}
+
+	cases := []struct {
+		in        string
+		u         Usage
+		wantStart string
+		wantEnd   string
+		wantDesc  string
+		wantCodes []string
+	}{
+		{``, u, "2019-09-03", "2019-10-02", "Ting 2019-09-03..2019-10-02", []string{WarnDerivedPeriod}},
+		{`periodStart = "2019-09-01"
+periodEnd = "2019-09-30"`, u, "2019-09-01", "2019-09-30", "Ting 2019-09-01..2019-09-30", nil},
+		{`description = "September"`, u, "2019-09-03", "2019-10-02", "September", []string{WarnDerivedPeriod}},
+		{`description = "September"`, Usage{}, "", "", "September", nil},
+		{``, uneven, "2019-08-20", "2019-10-02", "Ting 2019-08-20..2019-10-02", []string{WarnDerivedPeriod, WarnDateRanges}},
+	}
+
+	for _, c := range cases {
+		in := c.in + `
+
+[[devices]]
+deviceId = "1112223333"
+owner = "owner1"`
+
+		bil, err := ParseBill(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("ParseBill(%v) err, %v", in, err)
+		}
+
+		got, warnings := WithUsagePeriod(bil, c.u)
+
+		if got.PeriodStart.String() != c.wantStart || got.PeriodEnd.String() != c.wantEnd {
+			t.Errorf("WithUsagePeriod(%v) period == %s to %s, want %s to %s", c.in, got.PeriodStart, got.PeriodEnd, c.wantStart, c.wantEnd)
+		}
+
+		if got.Description != c.wantDesc {
+			t.Errorf("WithUsagePeriod(%v) Description == %q, want %q", c.in, got.Description, c.wantDesc)
+		}
+
+		var codes []string
+		for _, w := range warnings {
+			codes = append(codes, w.Code)
+		}
+		if !cmp.Equal(codes, c.wantCodes) {
+			t.Errorf("WithUsagePeriod(%v) warnings == %v, want %v", c.in, codes, c.wantCodes)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	in := `Date,Time,Phone,Duration (min)
+"February 03, 2011",01:11,1112223333,1
+"February 03, 2011",01:12,1112223333,1.5
+"February 03, 2011",01:13
+"Feb 3rd",01:14,1112223333,2
+"February 03, 2011",01:15,1112224444,3`
+
+	wantErrs := []ParseError{
+		{File: "minutes.csv", Line: 3, Column: "Duration (min)", Value: "1.5"},
+		{File: "minutes.csv", Line: 4},
+		{File: "minutes.csv", Line: 5, Column: "Date", Value: "Feb 3rd"},
+	}
+
+	_, _, err := ParseMinutes(strings.NewReader(in), ParseOptions{File: "minutes.csv"})
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("ParseMinutes(%v) err == %v, want a *ParseError", in, err)
+	}
+
+	if pe.File != wantErrs[0].File || pe.Line != wantErrs[0].Line || pe.Column != wantErrs[0].Column || pe.Value != wantErrs[0].Value {
+		t.Errorf("ParseMinutes(%v) err == %+v, want %+v", in, *pe, wantErrs[0])
+	}
+
+	got, warnings, err := ParseMinutes(strings.NewReader(in), ParseOptions{File: "minutes.csv", Lenient: true})
+	if err != nil {
+		t.Fatalf("ParseMinutes(%v) lenient err, %v", in, err)
+	}
+
+	if len(got) != 2 || got[0].DeviceID != "1112223333" || got[1].DeviceID != "1112224444" {
+		t.Errorf("ParseMinutes(%v) lenient == %v, want the first and last rows", in, got)
+	}
+
+	var gotErrs []ParseError
+	for _, w := range warnings {
+		if w.Code != WarnBadRow {
+			t.Errorf("ParseMinutes(%v) lenient warning %s, want only %s", in, w.Code, WarnBadRow)
+			continue
+		}
+
+		line, _ := strconv.Atoi(w.Context["line"])
+		gotErrs = append(gotErrs, ParseError{File: w.Context["file"], Line: line, Column: w.Context["column"], Value: w.Context["value"]})
+	}
+
+	if !cmp.Equal(gotErrs, wantErrs, cmpopts.IgnoreFields(ParseError{}, "Err")) {
+		t.Errorf("ParseMinutes(%v) lenient bad rows == %+v, want %+v", in, gotErrs, wantErrs)
+	}
+}
@@ -0,0 +1,210 @@
+package tingparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+)
+
+// Unknown device policies decide what happens to usage in the csv files for deviceIds which
+// aren't on the Bill. Set with `unknownDevices` in bill.toml.
+const (
+	// UnknownDevicesIgnore leaves the usage out of the split entirely. This is the default.
+	UnknownDevicesIgnore = "ignore"
+	// UnknownDevicesFail stops the split with an error.
+	UnknownDevicesFail = "fail"
+	// UnknownDevicesAdd adds the device to the split, with the owner tingbill.UnknownOwner.
+	UnknownDevicesAdd = "add"
+)
+
+// validUnknownDevices returns true if p is empty (use the default) or a known unknown device policy.
+func validUnknownDevices(p string) bool {
+	return p == "" || p == UnknownDevicesIgnore || p == UnknownDevicesFail || p == UnknownDevicesAdd
+}
+
+// checkUnknownDevices makes sure `unknownDevices` in bill.toml is a known policy. Devices added by
+// the "add" policy don't have a weight, so it can't be used with a "weighted" split between every
+// device.
+func checkUnknownDevices(b tingbill.Bill) error {
+	if !validUnknownDevices(b.UnknownDevices) {
+		return fmt.Errorf("unknown unknownDevices %q, expected %q, %q or %q", b.UnknownDevices, UnknownDevicesIgnore, UnknownDevicesFail, UnknownDevicesAdd)
+	}
+
+	if b.UnknownDevices != UnknownDevicesAdd {
+		return nil
+	}
+
+	type namedPolicy struct {
+		name string
+		p    tingbill.SplitPolicy
+	}
+
+	policies := []namedPolicy{
+		{"split.minutes", b.Split.Minutes},
+		{"split.messages", b.Split.Messages},
+		{"split.megabytes", b.Split.Megabytes},
+		{"split.devices", b.Split.Devices},
+		{"split.fees", b.Split.Fees},
+	}
+
+	// Charges for a single device or owner are never split with added devices
+	for _, kind := range []struct {
+		name    string
+		charges []tingbill.Charge
+	}{
+		{"charge", b.Charges},
+		{"credit", b.Credits},
+	} {
+		for _, c := range kind.charges {
+			if c.DeviceID == "" && c.Owner == "" {
+				policies = append(policies, namedPolicy{fmt.Sprintf("%s %q", kind.name, c.Name), c.SplitPolicy})
+			}
+		}
+	}
+
+	for _, policy := range policies {
+		if policy.p.Strategy == StrategyWeighted {
+			return fmt.Errorf("%s uses the %q strategy, which needs a weight for every device, so it can't be used with unknownDevices %q, set it to %q or %q instead",
+				policy.name, StrategyWeighted, UnknownDevicesAdd, UnknownDevicesIgnore, UnknownDevicesFail)
+		}
+	}
+
+	return nil
+}
+
+// DeviceIDs returns every deviceId with a row in u, sorted.
+func (u Usage) DeviceIDs() []string {
+	seen := make(map[string]int)
+
+	for _, r := range u.Minutes {
+		seen[r.DeviceID]++
+	}
+
+	for _, r := range u.Messages {
+		seen[r.DeviceID]++
+	}
+
+	for _, r := range u.Megabytes {
+		seen[r.DeviceID]++
+	}
+
+	return sortedKeys(seen)
+}
+
+// unknownDevices applies the Bill's unknown device policy to the rows in u for deviceIds which
+// aren't on the Bill. It returns the usage to split, the devices to add to the Bill, and a
+// warning for each unknown device, or an error with the "fail" policy.
+func unknownDevices(u Usage, bil tingbill.Bill) (Usage, []tingbill.Device, []tingbill.Warning, error) {
+	onBill := make(map[string]bool)
+	for _, id := range bil.DeviceIds() {
+		onBill[id] = true
+	}
+
+	var unknown []string
+	for _, id := range u.DeviceIDs() {
+		if !onBill[id] {
+			unknown = append(unknown, id)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return u, nil, nil, nil
+	}
+
+	switch bil.UnknownDevices {
+	case UnknownDevicesFail:
+		return u, nil, nil, fmt.Errorf("the usage csv files have usage for deviceIds %s, which aren't on the bill, add them to bill.toml or set unknownDevices", strings.Join(unknown, ", "))
+	case UnknownDevicesAdd:
+		var added []tingbill.Device
+		var warnings []tingbill.Warning
+
+		for _, id := range unknown {
+			added = append(added, tingbill.Device{DeviceID: id, Owner: tingbill.UnknownOwner})
+			warnings = append(warnings, tingbill.Warning{
+				Code:     WarnUnknownDevice,
+				Severity: tingbill.SeverityWarning,
+				Message:  fmt.Sprintf("deviceId %s has usage, but isn't on the bill, added it to the split with owner %s", id, tingbill.UnknownOwner),
+				Context:  map[string]string{"deviceId": id, "owner": tingbill.UnknownOwner},
+			})
+		}
+
+		return u, added, warnings, nil
+	}
+
+	return knownUsage(u, onBill), nil, unknownUsageWarnings(u, onBill), nil
+}
+
+// knownUsage returns u without the rows for deviceIds which aren't onBill.
+func knownUsage(u Usage, onBill map[string]bool) Usage {
+	var known Usage
+
+	for _, r := range u.Minutes {
+		if onBill[r.DeviceID] {
+			known.Minutes = append(known.Minutes, r)
+		}
+	}
+
+	for _, r := range u.Messages {
+		if onBill[r.DeviceID] {
+			known.Messages = append(known.Messages, r)
+		}
+	}
+
+	for _, r := range u.Megabytes {
+		if onBill[r.DeviceID] {
+			known.Megabytes = append(known.Megabytes, r)
+		}
+	}
+
+	return known
+}
+
+// unknownUsageWarnings returns a WarnUnknownDevice warning for each usage category of each
+// deviceId which isn't onBill, with the usage left out of the split.
+func unknownUsageWarnings(u Usage, onBill map[string]bool) []tingbill.Warning {
+	min := make(map[string]int)
+	for _, r := range u.Minutes {
+		if !onBill[r.DeviceID] {
+			min[r.DeviceID] += r.Minutes
+		}
+	}
+
+	msg := make(map[string]int)
+	for _, r := range u.Messages {
+		if !onBill[r.DeviceID] {
+			msg[r.DeviceID]++
+		}
+	}
+
+	meg := make(map[string]int)
+	for _, r := range u.Megabytes {
+		if !onBill[r.DeviceID] {
+			meg[r.DeviceID] += r.Kilobytes
+		}
+	}
+
+	categories := []struct {
+		name  string
+		usage map[string]int
+	}{
+		{CategoryMinutes, min},
+		{CategoryMessages, msg},
+		{CategoryMegabytes, meg},
+	}
+
+	var warnings []tingbill.Warning
+	for _, c := range categories {
+		for _, id := range sortedKeys(c.usage) {
+			warnings = append(warnings, tingbill.Warning{
+				Code:     WarnUnknownDevice,
+				Severity: tingbill.SeverityWarning,
+				Message:  fmt.Sprintf("%s usage for deviceId %s, which isn't on the bill, is left out of the split", c.name, id),
+				Context:  map[string]string{"category": c.name, "deviceId": id, "usage": strconv.Itoa(c.usage[id])},
+			})
+		}
+	}
+
+	return warnings
+}
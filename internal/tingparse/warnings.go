@@ -0,0 +1,98 @@
+package tingparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// Codes of the tingbill.Warnings returned by the parsers and CalculateSplit.
+const (
+	// WarnEmptyFile means a usage csv file had no header row, so it's treated as having no usage.
+	WarnEmptyFile = "csv-empty"
+	// WarnNoRows means a usage csv file had a header row, but no usage rows.
+	WarnNoRows = "csv-no-rows"
+	// WarnUnknownDevice means a usage csv file has usage for a deviceId which isn't on the Bill.
+	// That usage is left out of the split, or the device is added, by the unknown device policy.
+	WarnUnknownDevice = "unknown-device"
+	// WarnNoUsage means a device on the Bill has no usage at all for the billing period.
+	WarnNoUsage = "device-no-usage"
+	// WarnRemainder means leftover cents were handed out by the remainder policy when a
+	// cost was split.
+	WarnRemainder = "remainder-cents"
+)
+
+// emptyFileWarning returns a WarnEmptyFile warning for the usage csv file of category.
+func emptyFileWarning(category string) tingbill.Warning {
+	return tingbill.Warning{
+		Code:     WarnEmptyFile,
+		Severity: tingbill.SeverityWarning,
+		Message:  fmt.Sprintf("%s csv file is empty, treating it as no usage", category),
+		Context:  map[string]string{"file": category},
+	}
+}
+
+// noRowsWarning returns a WarnNoRows warning for the usage csv file of category.
+func noRowsWarning(category string) tingbill.Warning {
+	return tingbill.Warning{
+		Code:     WarnNoRows,
+		Severity: tingbill.SeverityInfo,
+		Message:  fmt.Sprintf("%s csv file has no usage rows", category),
+		Context:  map[string]string{"file": category},
+	}
+}
+
+// usageWarnings checks the usage maps passed to CalculateSplit against the Bill's devices, and
+// warns about devices without any usage.
+func usageWarnings(min map[string]decimal.Decimal, msg map[string]decimal.Decimal, meg map[string]int, bil tingbill.Bill) []tingbill.Warning {
+	var warnings []tingbill.Warning
+
+	for _, id := range bil.DeviceIds() {
+		if min[id].IsZero() && msg[id].IsZero() && meg[id] == 0 {
+			warnings = append(warnings, tingbill.Warning{
+				Code:     WarnNoUsage,
+				Severity: tingbill.SeverityInfo,
+				Message:  fmt.Sprintf("deviceId %s has no usage for the billing period", id),
+				Context:  map[string]string{"deviceId": id},
+			})
+		}
+	}
+
+	return warnings
+}
+
+// remainderWarning returns a WarnRemainder warning if the remainder policy had to hand out
+// leftover cents when splitting item, listing the devices that received them.
+func remainderWarning(item string, a allocation) (tingbill.Warning, bool) {
+	var adjusted []string
+	for _, id := range a.IDs {
+		if !a.Shares[id].Equal(a.Rounded[id]) {
+			adjusted = append(adjusted, id)
+		}
+	}
+
+	if len(adjusted) == 0 {
+		return tingbill.Warning{}, false
+	}
+
+	return tingbill.Warning{
+		Code:     WarnRemainder,
+		Severity: tingbill.SeverityInfo,
+		Message:  fmt.Sprintf("leftover cents when splitting %s went to %s", item, strings.Join(adjusted, ", ")),
+		Context:  map[string]string{"item": item, "deviceIds": strings.Join(adjusted, ",")},
+	}, true
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
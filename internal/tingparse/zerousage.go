@@ -0,0 +1,99 @@
+package tingparse
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// Zero usage policies decide how a usage category's cost is split when none of the devices
+// splitting it used anything, so there's nothing to split by. Set with `zeroUsagePolicy` in
+// bill.toml.
+const (
+	// ZeroUsageEven splits the cost evenly between the devices. This is the default.
+	ZeroUsageEven = "even"
+	// ZeroUsageShortStraw gives the whole cost to the Bill's ShortStrawID.
+	ZeroUsageShortStraw = "shortStraw"
+	// ZeroUsageShared moves the cost into the shared costs, split like devicesCost.
+	ZeroUsageShared = "shared"
+)
+
+// WarnZeroUsage means a cost based on usage had no usage to split by, and a zero usage
+// policy was used instead.
+const WarnZeroUsage = "zero-usage"
+
+// validZeroUsagePolicy returns true if p is empty (use the default) or a known zero usage policy.
+func validZeroUsagePolicy(p string) bool {
+	return p == "" || p == ZeroUsageEven || p == ZeroUsageShortStraw || p == ZeroUsageShared
+}
+
+// zeroUsagePolicy returns the Bill's zero usage policy, or the default if it doesn't set one.
+func zeroUsagePolicy(bil tingbill.Bill) string {
+	if bil.ZeroUsagePolicy == "" {
+		return ZeroUsageEven
+	}
+
+	return bil.ZeroUsagePolicy
+}
+
+// usesUsage returns true if the strategy named, with the settings in p, can only split a cost by
+// usage. "hybrid" only does when its evenPercent is 0, otherwise it already splits evenly when
+// there's no usage.
+func usesUsage(strategy string, p tingbill.SplitPolicy) bool {
+	switch strategy {
+	case StrategyProportional, StrategyTiered, StrategyShapley:
+		return true
+	case StrategyHybrid:
+		return p.EvenPercent.IsZero()
+	}
+
+	return false
+}
+
+// needsZeroUsage returns true if amount can't be split between ids with the strategy named, and
+// the settings in p, because none of them have any usage.
+func needsZeroUsage(amount decimal.Decimal, ids []string, strategy string, p tingbill.SplitPolicy, usage map[string]decimal.Decimal) bool {
+	if amount.IsZero() || usage == nil || !usesUsage(strategy, p) {
+		return false
+	}
+
+	for _, id := range ids {
+		if !usage[id].IsZero() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitZeroUsage splits amount between ids by the "even" or "shortStraw" zero usage policy.
+// If the Bill's ShortStrawID isn't one of ids, the first of ids gets the cost instead.
+func splitZeroUsage(amount decimal.Decimal, ids []string, policy string, bil tingbill.Bill) (allocation, error) {
+	if policy != ZeroUsageShortStraw {
+		return splitWith(amount, ids, EvenStrategy{}, nil, bil)
+	}
+
+	shortStrawID := bil.ShortStrawID
+	if sliceIndex(len(ids), func(i int) bool { return ids[i] == shortStrawID }) < 0 {
+		shortStrawID = ids[0]
+	}
+
+	weights := make(map[string]decimal.Decimal)
+	for _, id := range ids {
+		weights[id] = decimal.Zero
+	}
+	weights[shortStrawID] = decimal.New(1, 0)
+
+	return allocate(amount, ids, weights, bil.RemainderPolicy, shortStrawID)
+}
+
+// zeroUsageWarning returns a WarnZeroUsage warning for item, split using policy.
+func zeroUsageWarning(item string, amount decimal.Decimal, policy string) tingbill.Warning {
+	return tingbill.Warning{
+		Code:     WarnZeroUsage,
+		Severity: tingbill.SeverityWarning,
+		Message:  fmt.Sprintf("no usage to split $%s of %s by, used the %q zero usage policy", amount.StringFixed(CentPrecision), item, policy),
+		Context:  map[string]string{"item": item, "policy": policy},
+	}
+}
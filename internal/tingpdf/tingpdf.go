@@ -1,19 +1,24 @@
 package tingpdf
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/hitjim/ting-bill-split/internal/tingbill"
 	"github.com/jung-kurt/gofpdf"
 	"github.com/shopspring/decimal"
 )
 
-// GeneratePDF accepts a tingbill.BillSplit, tingbill.Bill, filepath string, and returns a string
-// containing a filepath for the newly generated Ting Bill Split PDF, and an error.
+// Options controls the optional parts of the generated PDF.
+// Methodology adds a page explaining every step of the calculation for each device.
+type Options struct {
+	Methodology bool
+}
+
+// GeneratePDF accepts a tingbill.BillSplit, tingbill.Bill, filepath string and Options, and returns
+// a string containing a filepath for the newly generated Ting Bill Split PDF, and an error.
 // The tingbill.Bill should be the same one that generated the tingbill.BillSplit.
-func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (string, error) {
-	fmt.Printf("\nGenerating invoice PDF...\n")
+func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string, opts Options) (string, error) {
 	const RoundPrecision = int32(2)
 
 	pdf := gofpdf.New("P", "mm", "A4", "")
@@ -39,6 +44,8 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		msgCosts := decimal.New(0, 1)
 		megCosts := decimal.New(0, 1)
 		shrCosts := decimal.New(0, 1)
+		chgCosts := decimal.New(0, 1)
+		surCosts := decimal.New(0, 1)
 
 		for _, v := range bs.MinuteCosts {
 			minCosts = minCosts.Add(v)
@@ -53,18 +60,27 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		for _, v := range bs.SharedCosts {
 			shrCosts = shrCosts.Add(v)
 		}
+		for _, v := range bs.SurchargeCosts {
+			surCosts = surCosts.Add(v)
+		}
+		for _, c := range bs.Charges {
+			chgCosts = chgCosts.Add(c.Amount)
+		}
+		for _, c := range bs.Credits {
+			chgCosts = chgCosts.Add(c.Amount)
+		}
 
-		calcCost := decimal.Sum(minCosts, msgCosts, megCosts, shrCosts).Round(RoundPrecision)
+		calcCost := decimal.Sum(minCosts, msgCosts, megCosts, shrCosts, surCosts, chgCosts).Round(RoundPrecision)
 		usgCost := decimal.Sum(minCosts, msgCosts, megCosts).Round(RoundPrecision)
 
 		values := []string{
 			b.Description,
 			strconv.Itoa(len(b.Devices)),
-			strconv.FormatFloat(b.Total, 'f', 2, 64),
+			b.Total.StringFixed(2),
 			calcCost.StringFixed(2),
 			usgCost.StringFixed(2),
-			strconv.FormatFloat(b.DevicesCost, 'f', 2, 64),
-			strconv.FormatFloat(b.Fees, 'f', 2, 64),
+			b.DevicesCost.StringFixed(2),
+			b.Fees.StringFixed(2),
 		}
 
 		pdf.SetX(10)
@@ -77,8 +93,11 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	}
 	headingTable(b, bs)
 
-	// Table 1: Usage - 8 columns, <deviceID qty>+1 rows
-	// heading: number, nickname?, min, msg, data (KB), min%, msg%, data%
+	// Table 1: Usage - 13 columns, <deviceID qty>+1 rows
+	// heading: number, nickname?, minutes, min out, min in, messages, msg out, msg in, data (KB),
+	// min%, msg%, data%, active (proration factor). minutes and messages are the usage the counting
+	// policies count, which min% and msg% are shares of. Rows with no direction are only in those.
+	// It's printed a size smaller than the other tables to fit the page.
 	// Then entries for each number
 	// then entry for "Total" under nickname, and rest of sums
 	usageTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
@@ -87,16 +106,23 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		type usageTableVals struct {
 			id         string
 			owner      string
-			minutes    string
-			messages   string
+			min        string
+			minOut     string
+			minIn      string
+			msg        string
+			msgOut     string
+			msgIn      string
 			data       string
 			percentMin string
 			percentMsg string
 			percentMeg string
+			active     string
 		}
 
-		usageTableHeading := []string{"Phone Number", "Owner", "Minutes", "Messages", "Data (KB)", "Min%", "Msg%", "Data%"}
-		w := []float64{40.0, 30.0, 25.0, 25.0, 25.0, 15.0, 15.0, 15.0}
+		usageTableHeading := []string{"Phone Number", "Owner", "Minutes", "Min Out", "Min In", "Messages", "Msg Out", "Msg In", "Data (KB)", "Min%", "Msg%", "Data%", "Active"}
+		w := []float64{25.0, 18.0, 14.0, 14.0, 12.0, 17.0, 15.0, 12.0, 17.0, 11.0, 11.0, 12.0, 12.0}
+		pdf.SetFont("Arial", "B", 9)
+		defer pdf.SetFont("Arial", "B", 10)
 		pdf.SetXY(10, pdf.GetY()+5)
 
 		// Print heading
@@ -113,12 +139,17 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			values[id] = usageTableVals{
 				id,
 				b.OwnerByID(id),
-				strconv.Itoa(bs.MinuteQty[id]),
-				strconv.Itoa(bs.MessageQty[id]),
+				bs.MinuteQty[id].String(),
+				strconv.Itoa(bs.MinuteOutQty[id]),
+				strconv.Itoa(bs.MinuteInQty[id]),
+				bs.MessageQty[id].String(),
+				strconv.Itoa(bs.MessageOutQty[id]),
+				strconv.Itoa(bs.MessageInQty[id]),
 				strconv.Itoa(bs.MegabyteQty[id]),
 				bs.MinutePercent[id].StringFixed(RoundPrecision),
 				bs.MessagePercent[id].StringFixed(RoundPrecision),
 				bs.MegabytePercent[id].StringFixed(RoundPrecision),
+				bs.Proration[id].StringFixed(RoundPrecision),
 			}
 		}
 
@@ -135,9 +166,17 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			wi++
 			pdf.CellFormat(w[wi], 7, row.owner, "1", 0, "C", false, 0, "")
 			wi++
-			pdf.CellFormat(w[wi], 7, row.minutes, "1", 0, "R", false, 0, "")
+			pdf.CellFormat(w[wi], 7, row.min, "1", 0, "R", false, 0, "")
 			wi++
-			pdf.CellFormat(w[wi], 7, row.messages, "1", 0, "R", false, 0, "")
+			pdf.CellFormat(w[wi], 7, row.minOut, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.minIn, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.msg, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.msgOut, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.msgIn, "1", 0, "R", false, 0, "")
 			wi++
 			pdf.CellFormat(w[wi], 7, row.data, "1", 0, "R", false, 0, "")
 			wi++
@@ -146,6 +185,8 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			pdf.CellFormat(w[wi], 7, row.percentMsg, "1", 0, "C", false, 0, "")
 			wi++
 			pdf.CellFormat(w[wi], 7, row.percentMeg, "1", 0, "C", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.active, "1", 0, "C", false, 0, "")
 			if i < valuesBound {
 				pdf.SetXY(10, pdf.GetY()+7)
 			}
@@ -154,6 +195,112 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	}
 	usageTable(b, bs)
 
+	// Table 1b: Data by network type - 6 columns, up to <deviceID qty>*<network type qty>+1 rows
+	// heading: number, Nickname, Network, Data (KB), Weight, Weighted (KB)
+	// entry for each network type each number used data on. Data% in the usage table is based
+	// on the weighted data. Only printed if the megabytes csv file has network types.
+	networkTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
+		types := bs.NetworkTypes()
+		if len(types) == 0 {
+			return
+		}
+
+		networkTableHeading := []string{"Phone Number", "Owner", "Network", "Data (KB)", "Weight", "Weighted (KB)"}
+		w := []float64{34.0, 28.0, 30.0, 30.0, 30.0, 38.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		// Print heading
+		for i, str := range networkTableHeading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		for _, id := range b.DeviceIds() {
+			for _, t := range types {
+				kb, ok := bs.MegabyteTypeQty[id][t]
+				if !ok {
+					continue
+				}
+
+				weight := b.NetworkWeight(t)
+				row := []string{
+					id,
+					b.OwnerByID(id),
+					t,
+					strconv.Itoa(kb),
+					weight.String(),
+					decimal.New(int64(kb), 0).Mul(weight).Round(0).String(),
+				}
+
+				pdf.SetX(10)
+				for i, str := range row {
+					align := "C"
+					if i == 3 || i == 5 {
+						align = "R"
+					}
+					pdf.CellFormat(w[i], 7, str, "1", 0, align, false, 0, "")
+				}
+				pdf.Ln(-1)
+			}
+		}
+	}
+	networkTable(b, bs)
+
+	// Table 1c: Roaming & international - 7 columns, <devices with international usage qty>+1 rows
+	// heading: number, Nickname, Intl Min, Intl Msg, Countries, Min, Msg
+	// entry for each number with roaming or international usage, and what it pays for it, which
+	// is included in its Min and Msg costs. Only printed if there was any.
+	internationalTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
+		var ids []string
+		for _, id := range b.DeviceIds() {
+			if bs.InternationalMinuteQty[id] > 0 || bs.InternationalMessageQty[id] > 0 {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 0 {
+			return
+		}
+
+		internationalTableHeading := []string{"Phone Number", "Owner", "Intl Min", "Intl Msg", "Countries", "$Min", "$Msg"}
+		w := []float64{28.0, 24.0, 20.0, 20.0, 52.0, 23.0, 23.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		pdf.CellFormat(190.0, 7, "Roaming & international", "1", 0, "C", false, 0, "")
+		pdf.Ln(-1)
+
+		// Print heading
+		for i, str := range internationalTableHeading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		for _, id := range ids {
+			row := []string{
+				id,
+				b.OwnerByID(id),
+				strconv.Itoa(bs.InternationalMinuteQty[id]),
+				strconv.Itoa(bs.InternationalMessageQty[id]),
+				strings.Join(bs.InternationalCountries[id], ", "),
+				bs.InternationalMinuteCosts[id].StringFixed(2),
+				bs.InternationalMessageCosts[id].StringFixed(2),
+			}
+
+			pdf.SetX(10)
+			for i, str := range row {
+				align := "R"
+				if i < 2 || i == 4 {
+					align = "C"
+				}
+				pdf.CellFormat(w[i], 7, str, "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+	}
+	internationalTable(b, bs)
+
 	// Table 2: Weighted Cost Type - 4 columns, 4 rows (+1 for cell to right of final column)
 	// heading: Weighted: Minutes, Messages, Data
 	// Base: $x, $y, $z
@@ -177,29 +324,29 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		pdf.Ln(-1)
 
 		// Prep data
-		totalMin := b.Minutes + b.ExtraMinutes
-		totalMsg := b.Messages + b.ExtraMessages
-		totalMeg := b.Megabytes + b.ExtraMegabytes
-		wTotal := strconv.FormatFloat(totalMin+totalMsg+totalMeg, 'f', 2, 64)
+		totalMin := b.Minutes.Add(b.ExtraMinutes)
+		totalMsg := b.Messages.Add(b.ExtraMessages)
+		totalMeg := b.Megabytes.Add(b.ExtraMegabytes)
+		wTotal := decimal.Sum(totalMin, totalMsg, totalMeg).StringFixed(2)
 
 		values := []weightedTableVals{
 			{
 				name:     "Base",
-				minutes:  strconv.FormatFloat(b.Minutes, 'f', 2, 64),
-				messages: strconv.FormatFloat(b.Messages, 'f', 2, 64),
-				data:     strconv.FormatFloat(b.Megabytes, 'f', 2, 64),
+				minutes:  b.Minutes.StringFixed(2),
+				messages: b.Messages.StringFixed(2),
+				data:     b.Megabytes.StringFixed(2),
 			},
 			{
 				name:     "Extra",
-				minutes:  strconv.FormatFloat(b.ExtraMinutes, 'f', 2, 64),
-				messages: strconv.FormatFloat(b.ExtraMessages, 'f', 2, 64),
-				data:     strconv.FormatFloat(b.ExtraMegabytes, 'f', 2, 64),
+				minutes:  b.ExtraMinutes.StringFixed(2),
+				messages: b.ExtraMessages.StringFixed(2),
+				data:     b.ExtraMegabytes.StringFixed(2),
 			},
 			{
 				name:     "Total",
-				minutes:  strconv.FormatFloat(totalMin, 'f', 2, 64),
-				messages: strconv.FormatFloat(totalMsg, 'f', 2, 64),
-				data:     strconv.FormatFloat(totalMeg, 'f', 2, 64),
+				minutes:  totalMin.StringFixed(2),
+				messages: totalMsg.StringFixed(2),
+				data:     totalMeg.StringFixed(2),
 			},
 		}
 
@@ -228,7 +375,7 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	// Devices: $
 	// Tax & Reg: $
 	// Total: $
-	sharedTable := func(b tingbill.Bill) {
+	sharedTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
 		type sharedTableVals struct {
 			costType string
 			amount   string
@@ -244,23 +391,37 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		pdf.Ln(-1)
 
 		// Prep data
-		sTotal := strconv.FormatFloat(b.DevicesCost+b.Fees, 'f', 2, 64)
+		sTotal := b.DevicesCost.Add(b.Fees)
 
 		values := []sharedTableVals{
 			{
 				costType: "Devices",
-				amount:   strconv.FormatFloat(b.DevicesCost, 'f', 2, 64),
+				amount:   b.DevicesCost.StringFixed(2),
 			},
 			{
 				costType: "Tax & Reg",
-				amount:   strconv.FormatFloat(b.Fees, 'f', 2, 64),
-			},
-			{
-				costType: "Total",
-				amount:   sTotal,
+				amount:   b.Fees.StringFixed(2),
 			},
 		}
 
+		// Usage categories nobody used, moved into the shared costs
+		for _, z := range bs.ZeroUsage {
+			if !z.MovedToShared() {
+				continue
+			}
+
+			sTotal = sTotal.Add(z.Amount)
+			values = append(values, sharedTableVals{
+				costType: z.Item,
+				amount:   z.Amount.StringFixed(2),
+			})
+		}
+
+		values = append(values, sharedTableVals{
+			costType: "Total",
+			amount:   sTotal.StringFixed(2),
+		})
+
 		// Print data
 		pdf.SetXY(10, pdf.GetY())
 		valuesBound := len(values) - 1
@@ -275,10 +436,131 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		}
 		pdf.Ln(-1)
 	}
-	sharedTable(b)
+	sharedTable(b, bs)
+
+	// Table 3b: No usage - 3 columns, <zero usage qty>+1 rows
+	// heading: No usage, Policy, Amount
+	// entry for each cost nobody used, and the zero usage policy it was split by instead.
+	// Only printed if there were any.
+	zeroUsageTable := func(bs tingbill.BillSplit) {
+		if len(bs.ZeroUsage) == 0 {
+			return
+		}
+
+		zuheading := []string{"No usage", "Policy", "$Amount"}
+		w := []float64{50.0, 30.0, 25.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		// Print heading
+		for i, str := range zuheading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		for _, z := range bs.ZeroUsage {
+			pdf.SetX(10)
+			pdf.CellFormat(w[0], 7, z.Item, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(w[1], 7, z.Policy, "1", 0, "C", false, 0, "")
+			pdf.CellFormat(w[2], 7, z.Amount.StringFixed(2), "1", 0, "R", false, 0, "")
+			pdf.Ln(-1)
+		}
+	}
+	zeroUsageTable(bs)
+
+	// Table 3c: Caps and floors - 5 columns, <limits applied qty>+1 rows
+	// heading: Applied to, Kind, Limit, Before, Adjustment
+	// entry for each cap or floor applied, in the order they were applied. The adjustment was
+	// split between the other devices. Only printed if there were any.
+	limitsTable := func(bs tingbill.BillSplit) {
+		if len(bs.Limits) == 0 {
+			return
+		}
 
-	// Table 4: Costs split - 7 columns, <deviceID qty>+1 rows
-	// heading: number, Nickname, Min, Msg, Data, Shared, Total
+		lheading := []string{"Applied to", "Kind", "$Limit", "$Before", "$Adjustment"}
+		w := []float64{50.0, 20.0, 25.0, 25.0, 30.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		// Print heading
+		for i, str := range lheading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		for _, l := range bs.Limits {
+			target := l.Target
+			if l.IsOwner {
+				target = "owner " + target
+			}
+
+			pdf.SetX(10)
+			pdf.CellFormat(w[0], 7, target, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(w[1], 7, l.Kind, "1", 0, "C", false, 0, "")
+			pdf.CellFormat(w[2], 7, l.Limit.StringFixed(2), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(w[3], 7, l.Before.StringFixed(2), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(w[4], 7, l.Adjustment.StringFixed(2), "1", 0, "R", false, 0, "")
+			pdf.Ln(-1)
+		}
+	}
+	limitsTable(bs)
+
+	// Table 4 and 5: Itemized charges, then credits - 7 columns, up to <charge qty>*<deviceID qty> rows
+	// heading: Charge (or Credit), Category, Split, Amount, number, Nickname, Share
+	// entry for each number, for each charge. Charges attached to a device or owner only have
+	// entries for those devices. Only printed if the bill has charges, or credits respectively.
+	chargesTable := func(b tingbill.Bill, kind string, charges []tingbill.ChargeSplit) {
+		if len(charges) == 0 {
+			return
+		}
+
+		chargesTableHeading := []string{kind, "Category", "Split", "$Amount", "Phone Number", "Owner", "$Share"}
+		w := []float64{35.0, 25.0, 25.0, 20.0, 30.0, 30.0, 25.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		// Print heading
+		for i, str := range chargesTableHeading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		ids := b.DeviceIds()
+
+		for _, c := range charges {
+			for _, id := range ids {
+				// Charges attached to a device or owner only get rows for those devices
+				if !c.Includes(id) {
+					continue
+				}
+
+				row := []string{
+					c.Name,
+					c.Category,
+					c.Strategy,
+					c.Amount.StringFixed(2),
+					id,
+					b.OwnerByID(id),
+					c.Costs[id].StringFixed(2),
+				}
+
+				pdf.SetX(10)
+				for i, str := range row {
+					align := "C"
+					if i == 3 || i == 6 {
+						align = "R"
+					}
+					pdf.CellFormat(w[i], 7, str, "1", 0, align, false, 0, "")
+				}
+				pdf.Ln(-1)
+			}
+		}
+	}
+	chargesTable(b, "Charge", bs.Charges)
+	chargesTable(b, "Credit", bs.Credits)
+
+	// Table 6: Costs split - 12 columns, <deviceID qty>+1 rows
+	// heading: number, Nickname, Min, Msg, Data, Shared, Surcharges, Charges, Device, Credits, Limits, Total
 	// entry for each number
 	splitTable := func(bs tingbill.BillSplit) {
 		type splitTableVals struct {
@@ -288,11 +570,16 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			messages string
 			data     string
 			shared   string
+			surch    string
+			charges  string
+			device   string
+			credits  string
+			limits   string
 			total    string
 		}
 
-		splitTableHeading := []string{"Phone Number", "Owner", "$Min", "$Msg", "$Data", "$Shared", "$Total"}
-		w := []float64{35.0, 30.0, 25.0, 25.0, 25.0, 25.0, 25.0}
+		splitTableHeading := []string{"Phone Number", "Owner", "$Min", "$Msg", "$Data", "$Shared", "$Surch.", "$Charges", "$Device", "$Credits", "$Limits", "$Total"}
+		w := []float64{22.0, 20.0, 14.0, 14.0, 14.0, 15.0, 14.0, 15.0, 14.0, 15.0, 14.0, 19.0}
 		pdf.SetXY(10, pdf.GetY()+5)
 
 		// Print heading
@@ -307,7 +594,6 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 		ids := b.DeviceIds()
 
 		for _, id := range ids {
-			userTotal := decimal.Sum(bs.MinuteCosts[id], bs.MessageCosts[id], bs.MegabyteCosts[id], bs.SharedCosts[id])
 			values[id] = splitTableVals{
 				id,
 				b.OwnerByID(id),
@@ -315,7 +601,12 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 				bs.MessageCosts[id].StringFixed(2),
 				bs.MegabyteCosts[id].StringFixed(2),
 				bs.SharedCosts[id].StringFixed(2),
-				userTotal.StringFixed(2),
+				bs.SurchargeCosts[id].StringFixed(2),
+				bs.ChargeTotal(id).StringFixed(2),
+				bs.DeviceChargeTotal(id).StringFixed(2),
+				bs.CreditTotal(id).StringFixed(2),
+				bs.LimitCosts[id].StringFixed(2),
+				bs.DeviceTotal(id).StringFixed(2),
 			}
 		}
 
@@ -340,6 +631,16 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 			wi++
 			pdf.CellFormat(w[wi], 7, row.shared, "1", 0, "R", false, 0, "")
 			wi++
+			pdf.CellFormat(w[wi], 7, row.surch, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.charges, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.device, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.credits, "1", 0, "R", false, 0, "")
+			wi++
+			pdf.CellFormat(w[wi], 7, row.limits, "1", 0, "R", false, 0, "")
+			wi++
 			pdf.CellFormat(w[wi], 7, row.total, "1", 0, "R", false, 0, "")
 			if i < valuesBound {
 				pdf.SetXY(10, pdf.GetY()+7)
@@ -349,11 +650,134 @@ func GeneratePDF(bs tingbill.BillSplit, b tingbill.Bill, filePath string) (strin
 	}
 	splitTable(bs)
 
-	err := pdf.OutputFileAndClose(filePath)
+	// Table 7: Amount due per owner - 12 columns, <owner qty>+1 rows
+	// heading: Owner, Lines, Min, Msg, Data, Shared, Surcharges, Charges, Device, Credits, Limits, Total
+	// entry for each owner, in the order they appear on bill.toml
+	ownerTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
+		ownerTableHeading := []string{"Owner", "Lines", "$Min", "$Msg", "$Data", "$Shared", "$Surch.", "$Charges", "$Device", "$Credits", "$Limits", "$Total"}
+		w := []float64{30.0, 12.0, 14.0, 14.0, 14.0, 15.0, 14.0, 15.0, 14.0, 15.0, 14.0, 19.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		pdf.CellFormat(190.0, 7, "Amount due per owner", "1", 0, "C", false, 0, "")
+		pdf.Ln(-1)
+
+		// Print heading
+		for i, str := range ownerTableHeading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		for _, owner := range b.Owners() {
+			o := bs.OwnerCosts[owner]
+			row := []string{
+				owner,
+				strconv.Itoa(len(o.DeviceIDs)),
+				o.MinuteCosts.StringFixed(2),
+				o.MessageCosts.StringFixed(2),
+				o.MegabyteCosts.StringFixed(2),
+				o.SharedCosts.StringFixed(2),
+				o.SurchargeCosts.StringFixed(2),
+				o.ChargeCosts.StringFixed(2),
+				o.DeviceCharges.StringFixed(2),
+				o.CreditCosts.StringFixed(2),
+				o.LimitCosts.StringFixed(2),
+				o.Total.StringFixed(2),
+			}
+
+			pdf.SetX(10)
+			for i, str := range row {
+				align := "R"
+				if i < 2 {
+					align = "C"
+				}
+				pdf.CellFormat(w[i], 7, str, "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+	}
+	ownerTable(b, bs)
+
+	// Table 8: Amount due per payer - 5 columns, <payer qty>*(<deviceID qty>+1) rows
+	// heading: Payer, number, Nickname, Share%, Amount
+	// entry for each number a payer pays for, then a "Total" entry for that payer
+	payerTable := func(b tingbill.Bill, bs tingbill.BillSplit) {
+		payerTableHeading := []string{"Payer", "Phone Number", "Owner", "Share%", "$Amount"}
+		w := []float64{40.0, 40.0, 40.0, 30.0, 40.0}
+		pdf.SetXY(10, pdf.GetY()+5)
+
+		pdf.CellFormat(190.0, 7, "Amount due per payer", "1", 0, "C", false, 0, "")
+		pdf.Ln(-1)
+
+		// Print heading
+		for i, str := range payerTableHeading {
+			pdf.CellFormat(w[i], 7, str, "1", 0, "C", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		// Print data
+		printRow := func(row []string) {
+			pdf.SetX(10)
+			for i, str := range row {
+				align := "C"
+				if i == 4 {
+					align = "R"
+				}
+				pdf.CellFormat(w[i], 7, str, "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+
+		for _, payer := range b.Payers() {
+			for _, d := range b.Devices {
+				amount, ok := bs.PayerCosts[payer][d.DeviceID]
+				if !ok {
+					continue
+				}
+
+				printRow([]string{
+					payer,
+					d.DeviceID,
+					d.Owner,
+					d.PayerShares()[payer].StringFixed(RoundPrecision),
+					amount.StringFixed(2),
+				})
+			}
+
+			printRow([]string{payer, "Total", "", "", bs.PayerTotal(payer).StringFixed(2)})
+		}
+	}
+	payerTable(b, bs)
+
+	// Methodology: the audit trail for every device, on its own page
+	methodologyPage := func(b tingbill.Bill, bs tingbill.BillSplit) {
+		pdf.AddPage()
+		pdf.SetFont("Arial", "B", 10)
+		pdf.SetXY(10, 20)
+		pdf.CellFormat(190.0, 7, "Methodology", "1", 0, "C", false, 0, "")
+		pdf.Ln(-1)
 
-	// TODO - add dates to bill. For now, entering manually in the "description" field in bill.toml
-	// Future: generate a range off min/max dates in usage files?
-	// Or maybe just have a new field in toml?
+		pdf.SetFont("Courier", "", 8)
+		pdf.SetY(pdf.GetY() + 3)
+
+		for _, id := range b.DeviceIds() {
+			lines, err := bs.Explain(b, id)
+			if err != nil {
+				continue
+			}
+
+			for _, line := range lines {
+				pdf.SetX(10)
+				pdf.CellFormat(190.0, 4, line, "", 1, "L", false, 0, "")
+			}
+			pdf.Ln(3)
+		}
+	}
+	if opts.Methodology {
+		methodologyPage(b, bs)
+	}
+
+	err := pdf.OutputFileAndClose(filePath)
 
 	return filePath, err
 }
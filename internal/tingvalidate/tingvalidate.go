@@ -0,0 +1,224 @@
+package tingvalidate
+
+import (
+	"fmt"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+// WarnMismatch is the code of the tingbill.Warning returned for every failed Check.
+const WarnMismatch = "reconcile-mismatch"
+
+// Line is one named amount in the breakdown of a Check.
+type Line struct {
+	Name   string
+	Amount decimal.Decimal
+}
+
+// Check compares an Expected amount, usually from the Ting bill, to the Actual amount it should
+// add up to. Breakdown lists the amounts that make up Actual.
+type Check struct {
+	Name      string
+	Expected  decimal.Decimal
+	Actual    decimal.Decimal
+	Breakdown []Line
+}
+
+// Difference returns how far Actual is off from Expected, rounded to the cent.
+func (c Check) Difference() decimal.Decimal {
+	return c.Actual.Sub(c.Expected).Round(2)
+}
+
+// OK returns true if Actual matches Expected to the cent.
+func (c Check) OK() bool {
+	return c.Difference().IsZero()
+}
+
+// Lines returns the Check as human-readable lines of text. The breakdown is only included
+// if the Check failed.
+func (c Check) Lines() []string {
+	if c.OK() {
+		return []string{fmt.Sprintf("OK    %s: $%s", c.Name, c.Expected.StringFixed(2))}
+	}
+
+	lines := []string{fmt.Sprintf("FAIL  %s: expected $%s, got $%s, off by $%s", c.Name, c.Expected.StringFixed(2), c.Actual.StringFixed(2), c.Difference().StringFixed(2))}
+
+	for _, l := range c.Breakdown {
+		lines = append(lines, fmt.Sprintf("        %-30s $%s", l.Name, l.Amount.StringFixed(2)))
+	}
+
+	return lines
+}
+
+// Report is the result of every Check run on a Bill, and optionally its BillSplit.
+type Report struct {
+	Checks []Check
+}
+
+// OK returns true if every Check passed.
+func (r Report) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Lines returns every Check in the Report as human-readable lines of text.
+func (r Report) Lines() []string {
+	var lines []string
+
+	for _, c := range r.Checks {
+		lines = append(lines, c.Lines()...)
+	}
+
+	return lines
+}
+
+// Warnings returns a tingbill.Warning for every failed Check.
+func (r Report) Warnings() []tingbill.Warning {
+	var warnings []tingbill.Warning
+
+	for _, c := range r.Checks {
+		if c.OK() {
+			continue
+		}
+
+		warnings = append(warnings, tingbill.Warning{
+			Code:     WarnMismatch,
+			Severity: tingbill.SeverityWarning,
+			Message:  fmt.Sprintf("%s: expected $%s, got $%s", c.Name, c.Expected.StringFixed(2), c.Actual.StringFixed(2)),
+			Context: map[string]string{
+				"check":      c.Name,
+				"expected":   c.Expected.StringFixed(2),
+				"actual":     c.Actual.StringFixed(2),
+				"difference": c.Difference().StringFixed(2),
+			},
+		})
+	}
+
+	return warnings
+}
+
+// Bill checks that every amount on the Bill adds up to its total. Credits are subtracted.
+func Bill(b tingbill.Bill) Report {
+	breakdown := []Line{
+		{"Devices", b.DevicesCost},
+		{"Minutes", b.Minutes},
+		{"Messages", b.Messages},
+		{"Data", b.Megabytes},
+		{"Extra minutes", b.ExtraMinutes},
+		{"Extra messages", b.ExtraMessages},
+		{"Extra data", b.ExtraMegabytes},
+		{"Tax & Reg", b.Fees},
+	}
+
+	// International usage may have its own lines on the Ting bill
+	if !b.International.Minutes.IsZero() {
+		breakdown = append(breakdown, Line{"International minutes", b.International.Minutes})
+	}
+
+	if !b.International.Messages.IsZero() {
+		breakdown = append(breakdown, Line{"International messages", b.International.Messages})
+	}
+
+	for _, c := range b.Charges {
+		breakdown = append(breakdown, Line{fmt.Sprintf("Charge %q", c.Name), c.Amount})
+	}
+
+	for _, c := range b.Credits {
+		breakdown = append(breakdown, Line{fmt.Sprintf("Credit %q", c.Name), c.Amount.Neg()})
+	}
+
+	return Report{Checks: []Check{sumCheck("Bill amounts add up to total", b.Total, breakdown)}}
+}
+
+// Split checks the Bill, then checks that the BillSplit calculated from it accounts for every
+// cost. b should be the same Bill that generated bs.
+func Split(bs tingbill.BillSplit, b tingbill.Bill) Report {
+	r := Bill(b)
+	ids := b.DeviceIds()
+
+	// Usage categories nobody used may have been moved into the shared costs
+	moved := decimal.Zero
+	for _, z := range bs.ZeroUsage {
+		if z.MovedToShared() {
+			moved = moved.Add(z.Amount)
+		}
+	}
+
+	usage := decimal.Sum(b.Minutes, b.Messages, b.Megabytes, b.ExtraMinutes, b.ExtraMessages, b.ExtraMegabytes,
+		b.International.Minutes, b.International.Messages).Sub(moved)
+	r.Checks = append(r.Checks, sumCheck("Usage split adds up to usage costs", usage, []Line{
+		{"Minutes", sum(bs.MinuteCosts, ids)},
+		{"Messages", sum(bs.MessageCosts, ids)},
+		{"Data", sum(bs.MegabyteCosts, ids)},
+	}))
+
+	// Surcharges are taken out of the shared costs, and paid by the devices which incurred them
+	surcharges := sum(bs.SurchargeCosts, ids)
+
+	var shared []Line
+	for _, id := range ids {
+		shared = append(shared, Line{id, bs.SharedCosts[id]})
+	}
+	r.Checks = append(r.Checks, sumCheck("Shared split adds up to shared costs", decimal.Sum(b.DevicesCost, b.Fees, moved).Sub(surcharges), shared))
+
+	for _, c := range bs.Charges {
+		r.Checks = append(r.Checks, chargeCheck("Charge", c, ids))
+	}
+
+	for _, c := range bs.Credits {
+		r.Checks = append(r.Checks, chargeCheck("Credit", c, ids))
+	}
+
+	var devices []Line
+	for _, id := range ids {
+		devices = append(devices, Line{fmt.Sprintf("%s (%s)", id, b.OwnerByID(id)), bs.DeviceTotal(id)})
+	}
+	split := sumCheck("Split adds up to total", b.Total, devices)
+	r.Checks = append(r.Checks, split)
+
+	var payers []Line
+	for _, p := range b.Payers() {
+		payers = append(payers, Line{p, bs.PayerTotal(p)})
+	}
+	r.Checks = append(r.Checks, sumCheck("Payers add up to split", split.Actual, payers))
+
+	return r
+}
+
+// chargeCheck checks that a Charge or credit was split exactly between its devices.
+func chargeCheck(kind string, c tingbill.ChargeSplit, ids []string) Check {
+	var breakdown []Line
+	for _, id := range ids {
+		if c.Includes(id) {
+			breakdown = append(breakdown, Line{id, c.Costs[id]})
+		}
+	}
+
+	return sumCheck(fmt.Sprintf("%s %q split adds up", kind, c.Name), c.Amount, breakdown)
+}
+
+// sumCheck returns a Check that breakdown adds up to expected.
+func sumCheck(name string, expected decimal.Decimal, breakdown []Line) Check {
+	actual := decimal.Zero
+	for _, l := range breakdown {
+		actual = actual.Add(l.Amount)
+	}
+
+	return Check{Name: name, Expected: expected, Actual: actual, Breakdown: breakdown}
+}
+
+// sum adds up the amounts in m for every id.
+func sum(m map[string]decimal.Decimal, ids []string) decimal.Decimal {
+	total := decimal.Zero
+	for _, id := range ids {
+		total = total.Add(m[id])
+	}
+
+	return total
+}
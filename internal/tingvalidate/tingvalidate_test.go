@@ -0,0 +1,94 @@
+package tingvalidate
+
+import (
+	"testing"
+
+	"github.com/hitjim/ting-bill-split/internal/tingbill"
+	"github.com/shopspring/decimal"
+)
+
+func testBill() tingbill.Bill {
+	return tingbill.Bill{
+		Devices: []tingbill.Device{
+			{DeviceID: "1112223333", Owner: "owner1"},
+			{DeviceID: "1112224444", Owner: "owner2"},
+		},
+		Total:       decimal.NewFromFloat(25),
+		DevicesCost: decimal.NewFromFloat(12),
+		Minutes:     decimal.NewFromFloat(3),
+		Fees:        decimal.NewFromFloat(5),
+		Charges:     []tingbill.Charge{{Name: "Hotspot", Amount: decimal.NewFromFloat(6)}},
+		Credits:     []tingbill.Charge{{Name: "Referral", Amount: decimal.NewFromFloat(1)}},
+	}
+}
+
+func TestBill(t *testing.T) {
+	b := testBill()
+
+	if r := Bill(b); !r.OK() {
+		t.Errorf("Bill(%v) failed, %v", b, r.Lines())
+	}
+
+	b.Total = decimal.NewFromFloat(24.5)
+	r := Bill(b)
+	if r.OK() {
+		t.Fatalf("Bill(%v) passed, want a mismatch", b)
+	}
+
+	if got, want := r.Checks[0].Difference(), decimal.NewFromFloat(0.5); !got.Equal(want) {
+		t.Errorf("Bill(%v) Difference() == %v, want %v", b, got, want)
+	}
+
+	if w := r.Warnings(); len(w) != 1 || w[0].Code != WarnMismatch {
+		t.Errorf("Bill(%v) Warnings() == %v, want one %s", b, w, WarnMismatch)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	b := testBill()
+
+	costs := func(a, b float64) map[string]decimal.Decimal {
+		return map[string]decimal.Decimal{"1112223333": decimal.NewFromFloat(a), "1112224444": decimal.NewFromFloat(b)}
+	}
+
+	bs := tingbill.BillSplit{
+		MinuteCosts:   costs(1, 2),
+		MessageCosts:  costs(0, 0),
+		MegabyteCosts: costs(0, 0),
+		SharedCosts:   costs(8.5, 8.5),
+		Charges:       []tingbill.ChargeSplit{{Name: "Hotspot", Amount: decimal.NewFromFloat(6), Costs: costs(3, 3)}},
+		Credits:       []tingbill.ChargeSplit{{Name: "Referral", Amount: decimal.NewFromFloat(-1), Costs: costs(-0.5, -0.5)}},
+		PayerCosts: map[string]map[string]decimal.Decimal{
+			"owner1": {"1112223333": decimal.NewFromFloat(12)},
+			"owner2": {"1112224444": decimal.NewFromFloat(13)},
+		},
+	}
+
+	if r := Split(bs, b); !r.OK() {
+		t.Errorf("Split(%v) failed, %v", bs, r.Lines())
+	}
+
+	// A device's share of the charge went missing
+	bs.Charges[0].Costs = costs(3, 2.99)
+	r := Split(bs, b)
+	if r.OK() {
+		t.Fatalf("Split(%v) passed, want a mismatch", bs)
+	}
+
+	var failed []string
+	for _, c := range r.Checks {
+		if !c.OK() {
+			failed = append(failed, c.Name)
+		}
+	}
+
+	want := []string{`Charge "Hotspot" split adds up`, "Split adds up to total", "Payers add up to split"}
+	if len(failed) != len(want) {
+		t.Fatalf("Split(%v) failed checks == %v, want %v", bs, failed, want)
+	}
+	for i := range want {
+		if failed[i] != want[i] {
+			t.Errorf("Split(%v) failed checks == %v, want %v", bs, failed, want)
+		}
+	}
+}